@@ -2,4 +2,4 @@ module github.com/tommie/tiny-foundationdb-go
 
 go 1.17
 
-require github.com/tidwall/btree v1.1.0 // indirect
+require github.com/tidwall/btree v1.1.0
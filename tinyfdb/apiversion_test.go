@@ -1,6 +1,7 @@
 package tinyfdb
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
@@ -34,4 +35,61 @@ func TestAPIVersion(t *testing.T) {
 			t.Errorf("GetAPIVersion: got %v, want %v", got, want)
 		}
 	})
+	t.Run("supported", func(t *testing.T) {
+		tsts := []struct {
+			Version int
+			WantErr bool
+		}{
+			{199, true},
+			{200, false},
+			{710, false},
+			{711, true},
+		}
+		for _, tst := range tsts {
+			t.Run(fmt.Sprint(tst.Version), func(t *testing.T) {
+				t.Cleanup(internal.ClearAPIVersion)
+
+				if err := APIVersion(tst.Version); (err != nil) != tst.WantErr {
+					t.Errorf("APIVersion err: got %v, want error %v", err, tst.WantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("readYourWritesDefault", func(t *testing.T) {
+		tsts := []struct {
+			Version int
+			Want    bool
+		}{
+			{0, true},
+			{299, false},
+			{300, true},
+		}
+		for _, tst := range tsts {
+			t.Run(fmt.Sprint(tst.Version), func(t *testing.T) {
+				t.Cleanup(internal.ClearAPIVersion)
+
+				if tst.Version != 0 {
+					if err := APIVersion(tst.Version); err != nil {
+						t.Fatalf("APIVersion failed: %v", err)
+					}
+				}
+
+				db, err := OpenDefault()
+				if err != nil {
+					t.Fatalf("OpenDefault failed: %v", err)
+				}
+				tx, err := db.CreateTransaction()
+				if err != nil {
+					t.Fatalf("CreateTransaction failed: %v", err)
+				}
+				tx.Set(Key("akey"), []byte("avalue"))
+
+				got := tx.Get(Key("akey")).MustGet() != nil
+				if got != tst.Want {
+					t.Errorf("Get sees own write: got %v, want %v", got, tst.Want)
+				}
+			})
+		}
+	})
 }
@@ -0,0 +1,250 @@
+package tinyfdb
+
+import (
+	"bytes"
+)
+
+// Add performs an addition of little-endian integers. If the existing
+// value in the database is not present or shorter than param, it is
+// first extended to the length of param with zero-bytes. If param is
+// shorter than the existing value in the database, the existing value
+// is truncated to match the length of param.
+func (t Transaction) Add(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationAdd)
+}
+
+// BitAnd performs a bitwise "and" operation. If the existing value in
+// the database is not present, then param is stored. Otherwise, the
+// existing value is extended or truncated like for Add.
+func (t Transaction) BitAnd(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationBitAnd)
+}
+
+// BitOr performs a bitwise "or" operation. The existing value is
+// extended or truncated like for Add.
+func (t Transaction) BitOr(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationBitOr)
+}
+
+// BitXor performs a bitwise "xor" operation. The existing value is
+// extended or truncated like for Add.
+func (t Transaction) BitXor(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationBitXor)
+}
+
+// Max stores the larger of the existing value and param, both
+// interpreted as unsigned little-endian integers. If the existing
+// value is not present, param is stored. Otherwise, the existing
+// value is extended or truncated like for Add.
+func (t Transaction) Max(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationMax)
+}
+
+// Min stores the smaller of the existing value and param, both
+// interpreted as unsigned little-endian integers. If the existing
+// value is not present, param is stored. Otherwise, the existing
+// value is extended or truncated like for Add.
+func (t Transaction) Min(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationMin)
+}
+
+// ByteMax stores the lexicographically larger of the existing value
+// and param. If the existing value is not present, param is stored.
+func (t Transaction) ByteMax(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationByteMax)
+}
+
+// ByteMin stores the lexicographically smaller of the existing value
+// and param. If the existing value is not present, param is stored.
+func (t Transaction) ByteMin(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationByteMin)
+}
+
+// CompareAndClear clears the key if the existing value is equal to
+// param.
+func (t Transaction) CompareAndClear(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationCompareAndClear)
+}
+
+// AppendIfFits appends param to the end of the existing value, unless
+// the result would be larger than the maximum value size. If the
+// existing value is not present, param is stored.
+func (t Transaction) AppendIfFits(key KeyConvertible, param []byte) {
+	t.atomicOp(key, param, mutationAppendIfFits)
+}
+
+// atomicOp records a mutation of the key. If the value the mutation
+// applies to is known, it is applied directly. Otherwise, it is
+// deferred until commit, where it applies to the latest committed
+// value. Since nothing is read, concurrent atomic operations don't
+// conflict with each other.
+func (t *transaction) atomicOp(key KeyConvertible, param []byte, typ mutationType) {
+	k := append(Key(nil), key.FDBKey()...)
+	op := mutation{typ, append([]byte{}, param...)}
+	if err := checkWriteSize(k, param); err != nil {
+		t.setInvalid(err)
+		return
+	}
+	t.write(k, keyAfter(k), func() {
+		if item := t.writes.Get(keyValue{Key: k, Seq: pendingSeq}); item != nil {
+			kv := item.(keyValue)
+			if kv.Ops != nil {
+				kv.Ops = append(kv.Ops[:len(kv.Ops):len(kv.Ops)], op)
+			} else {
+				kv.Value = op.apply(kv.Value)
+			}
+			t.writes.Set(kv)
+			return
+		}
+
+		if t.clears.Contains(k) {
+			t.writes.Set(keyValue{Key: k, Seq: pendingSeq, Value: op.apply(nil)})
+			return
+		}
+
+		t.writes.Set(keyValue{Key: k, Seq: pendingSeq, Ops: []mutation{op}})
+	})
+}
+
+// applyMutations returns the value after applying all ops on v. The
+// versionstamp is used by versionstamped values.
+func applyMutations(v []byte, ops []mutation, vs []byte) []byte {
+	for _, op := range ops {
+		if op.typ == mutationSetVersionstampedValue {
+			// The offset was validated when the mutation was added.
+			v, _ = placeVersionstamp(op.param, vs, true)
+			continue
+		}
+		v = op.apply(v)
+	}
+	return v
+}
+
+// hasVersionstamp returns whether ops cannot be applied until the
+// versionstamp is known.
+func hasVersionstamp(ops []mutation) bool {
+	for _, op := range ops {
+		if op.typ == mutationSetVersionstampedValue {
+			return true
+		}
+	}
+	return false
+}
+
+// A mutation is a deferred atomic operation.
+type mutation struct {
+	typ   mutationType
+	param []byte
+}
+
+type mutationType int
+
+const (
+	mutationAdd mutationType = iota
+	mutationBitAnd
+	mutationBitOr
+	mutationBitXor
+	mutationMax
+	mutationMin
+	mutationByteMax
+	mutationByteMin
+	mutationCompareAndClear
+	mutationAppendIfFits
+
+	// mutationSetVersionstampedValue is resolved by applyMutations.
+	mutationSetVersionstampedValue
+)
+
+// apply returns the result of the operation on the existing value v,
+// which is nil if the key doesn't exist. A nil result means the key
+// should be cleared.
+func (m mutation) apply(v []byte) []byte {
+	p := m.param
+
+	switch m.typ {
+	case mutationAdd:
+		r := make([]byte, len(p))
+		var carry int
+		for i := range p {
+			s := int(p[i]) + int(byteAt(v, i)) + carry
+			r[i] = byte(s)
+			carry = s >> 8
+		}
+		return r
+
+	case mutationBitAnd:
+		if v == nil {
+			return append([]byte{}, p...)
+		}
+		r := make([]byte, len(p))
+		for i := range p {
+			r[i] = p[i] & byteAt(v, i)
+		}
+		return r
+
+	case mutationBitOr:
+		r := make([]byte, len(p))
+		for i := range p {
+			r[i] = p[i] | byteAt(v, i)
+		}
+		return r
+
+	case mutationBitXor:
+		r := make([]byte, len(p))
+		for i := range p {
+			r[i] = p[i] ^ byteAt(v, i)
+		}
+		return r
+
+	case mutationMax, mutationMin:
+		if v == nil {
+			return append([]byte{}, p...)
+		}
+		r := make([]byte, len(p))
+		for i := range p {
+			r[i] = byteAt(v, i)
+		}
+		// Little-endian, so compare from the most significant byte.
+		c := 0
+		for i := len(p) - 1; i >= 0 && c == 0; i-- {
+			c = int(r[i]) - int(p[i])
+		}
+		if (m.typ == mutationMax && c < 0) || (m.typ == mutationMin && c > 0) {
+			copy(r, p)
+		}
+		return r
+
+	case mutationByteMax, mutationByteMin:
+		if v == nil {
+			return append([]byte{}, p...)
+		}
+		c := bytes.Compare(v, p)
+		if (m.typ == mutationByteMax && c < 0) || (m.typ == mutationByteMin && c > 0) {
+			return append([]byte{}, p...)
+		}
+		return v
+
+	case mutationCompareAndClear:
+		if v != nil && bytes.Equal(v, p) {
+			return nil
+		}
+		return v
+
+	case mutationAppendIfFits:
+		if len(v)+len(p) > valueSizeLimit {
+			return v
+		}
+		return append(append([]byte{}, v...), p...)
+
+	default:
+		panic("unknown mutation type")
+	}
+}
+
+// byteAt returns v[i], or zero if i is out of bounds.
+func byteAt(v []byte, i int) byte {
+	if i < len(v) {
+		return v[i]
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMutationApply(t *testing.T) {
+	tsts := []struct {
+		Name  string
+		Typ   mutationType
+		Value []byte
+		Param []byte
+
+		Want []byte
+	}{
+		{"addAbsent", mutationAdd, nil, []byte{1, 0}, []byte{1, 0}},
+		{"addCarry", mutationAdd, []byte{0xFF, 0}, []byte{1, 0}, []byte{0, 1}},
+		{"addOverflow", mutationAdd, []byte{0xFF, 0xFF}, []byte{1, 0}, []byte{0, 0}},
+		{"addExtend", mutationAdd, []byte{1}, []byte{1, 0, 0, 0}, []byte{2, 0, 0, 0}},
+		{"addTruncate", mutationAdd, []byte{1, 2, 3}, []byte{1}, []byte{2}},
+
+		{"bitAndAbsent", mutationBitAnd, nil, []byte{0x0F}, []byte{0x0F}},
+		{"bitAnd", mutationBitAnd, []byte{0x3C}, []byte{0x0F, 0xFF}, []byte{0x0C, 0}},
+		{"bitOrAbsent", mutationBitOr, nil, []byte{0x0F}, []byte{0x0F}},
+		{"bitOr", mutationBitOr, []byte{0x30}, []byte{0x0F}, []byte{0x3F}},
+		{"bitXor", mutationBitXor, []byte{0x3C}, []byte{0x0F}, []byte{0x33}},
+
+		{"maxAbsent", mutationMax, nil, []byte{1}, []byte{1}},
+		{"maxExisting", mutationMax, []byte{0, 2}, []byte{0xFF, 1}, []byte{0, 2}},
+		{"maxParam", mutationMax, []byte{0xFF, 1}, []byte{0, 2}, []byte{0, 2}},
+		{"maxTruncate", mutationMax, []byte{1, 0xFF}, []byte{2}, []byte{2}},
+		{"minAbsent", mutationMin, nil, []byte{1}, []byte{1}},
+		{"minExisting", mutationMin, []byte{0xFF, 1}, []byte{0, 2}, []byte{0xFF, 1}},
+		{"minExtend", mutationMin, []byte{1}, []byte{2, 0}, []byte{1, 0}},
+
+		{"byteMaxAbsent", mutationByteMax, nil, []byte("b"), []byte("b")},
+		{"byteMax", mutationByteMax, []byte("ab"), []byte("b"), []byte("b")},
+		{"byteMin", mutationByteMin, []byte("ab"), []byte("b"), []byte("ab")},
+
+		{"compareAndClearAbsent", mutationCompareAndClear, nil, []byte("a"), nil},
+		{"compareAndClearEqual", mutationCompareAndClear, []byte("a"), []byte("a"), nil},
+		{"compareAndClearDifferent", mutationCompareAndClear, []byte("b"), []byte("a"), []byte("b")},
+
+		{"appendIfFitsAbsent", mutationAppendIfFits, nil, []byte("a"), []byte("a")},
+		{"appendIfFits", mutationAppendIfFits, []byte("a"), []byte("b"), []byte("ab")},
+		{"appendIfFitsTooLarge", mutationAppendIfFits, []byte("a"), make([]byte, valueSizeLimit), []byte("a")},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			got := mutation{tst.Typ, tst.Param}.apply(tst.Value)
+			if !reflect.DeepEqual(got, tst.Want) {
+				t.Errorf("apply: got %v, want %v", got, tst.Want)
+			}
+		})
+	}
+}
+
+func TestTransactionAtomicOp(t *testing.T) {
+	t.Run("deferred", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key("akey"), Seq: 1, Value: []byte{1, 0}})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Add(Key("akey"), []byte{1, 0})
+
+			if want := (rangeSet{{Key("akey"), Key("akey\x00")}}); !reflect.DeepEqual(tx.writeConflicts, want) {
+				t.Errorf("Add writeConflicts: got %+v, want %+v", tx.writeConflicts, want)
+			}
+			if tx.readConflicts != nil {
+				t.Errorf("Add readConflicts: got %+v, want nil", tx.readConflicts)
+			}
+
+			got, err := tx.Get(Key("akey")).Get()
+			if err != nil {
+				return nil, err
+			}
+			if want := []byte{2, 0}; !bytes.Equal(got, want) {
+				t.Errorf("Get: got %v, want %v", got, want)
+			}
+
+			tx.Cancel()
+			return nil, nil
+		})
+		if !errors.Is(err, errTransactionCancelled) {
+			t.Fatalf("Transact err: got %v, want %v", err, errTransactionCancelled)
+		}
+	})
+
+	t.Run("afterSet", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		freezeClock(db)
+
+		db.bt.Set(keyValue{Key: Key("akey"), Seq: 1, Value: []byte{1, 0}})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key("akey"), []byte{5})
+			tx.Add(Key("akey"), []byte{1})
+			tx.Clear(Key("bkey"))
+			tx.Add(Key("bkey"), []byte{1})
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		for _, want := range []keyValue{
+			{Key: Key("akey"), Seq: 2, Value: []byte{6}},
+			{Key: Key("bkey"), Seq: 2, Value: []byte{1}},
+		} {
+			if got := db.bt.Get(want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Get: got %+v, want %+v", got, want)
+			}
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		freezeClock(db)
+
+		tx1, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx2, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		tx1.Add(Key("akey"), []byte{1, 0})
+		tx2.Add(Key("akey"), []byte{2, 0})
+
+		if err := tx1.Commit().Get(); err != nil {
+			t.Fatalf("Commit(1) failed: %v", err)
+		}
+		if err := tx2.Commit().Get(); err != nil {
+			t.Fatalf("Commit(2) failed: %v", err)
+		}
+
+		want := keyValue{Key: Key("akey"), Seq: 3, Value: []byte{3, 0}}
+		if got := db.bt.Get(want); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("conflictsWithReader", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key("akey"), Seq: 1, Value: []byte{1, 0}})
+
+		tx1, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx2, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		tx1.Add(Key("akey"), []byte{1, 0})
+		tx2.Get(Key("akey")).MustGet()
+		tx2.Set(Key("bkey"), []byte{1})
+
+		if err := tx1.Commit().Get(); err != nil {
+			t.Fatalf("Commit(1) failed: %v", err)
+		}
+		if err := tx2.Commit().Get(); err == nil {
+			t.Fatalf("Commit(2) err: got %v, want non-nil", err)
+		}
+	})
+}
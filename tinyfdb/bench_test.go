@@ -0,0 +1,164 @@
+package tinyfdb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// benchKeys is the number of keys populated by newBenchDatabase.
+const benchKeys = 10000
+
+func newBenchDatabase(b *testing.B) Database {
+	b.Helper()
+
+	db, err := OpenDefault()
+	if err != nil {
+		b.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	const perTx = 1000
+	for i := 0; i < benchKeys; i += perTx {
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			for j := i; j < i+perTx; j++ {
+				tx.Set(benchKey(j), []byte("value"))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			b.Fatalf("Transact failed: %v", err)
+		}
+	}
+
+	return db
+}
+
+func benchKey(i int) Key {
+	return Key(fmt.Sprintf("k%08d", i))
+}
+
+func BenchmarkTransactionGet(b *testing.B) {
+	db := newBenchDatabase(b)
+
+	b.Run("serial", func(b *testing.B) {
+		_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			for i := 0; i < b.N; i++ {
+				tx.Get(benchKey(i % benchKeys)).MustGet()
+			}
+			return nil, nil
+		})
+		if err != nil {
+			b.Fatalf("ReadTransact failed: %v", err)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+				for i := 0; pb.Next(); i++ {
+					tx.Get(benchKey(i % benchKeys)).MustGet()
+				}
+				return nil, nil
+			})
+			if err != nil {
+				b.Errorf("ReadTransact failed: %v", err)
+			}
+		})
+	})
+}
+
+func BenchmarkTransactionGetRange(b *testing.B) {
+	db := newBenchDatabase(b)
+
+	scan := func(b *testing.B, tx ReadTransaction) {
+		n := 0
+		it := tx.GetRange(KeyRange{Begin: benchKey(0), End: benchKey(benchKeys)}, RangeOptions{}).Iterator()
+		for it.Advance() {
+			if _, err := it.Get(); err != nil {
+				b.Errorf("Get failed: %v", err)
+				return
+			}
+			n++
+		}
+		if n != benchKeys {
+			b.Errorf("GetRange: got %d keys, want %d", n, benchKeys)
+		}
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+				scan(b, tx)
+				return nil, nil
+			})
+			if err != nil {
+				b.Fatalf("ReadTransact failed: %v", err)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+					scan(b, tx)
+					return nil, nil
+				})
+				if err != nil {
+					b.Errorf("ReadTransact failed: %v", err)
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkDatabaseTransact(b *testing.B) {
+	db := newBenchDatabase(b)
+
+	// Each commit writes a new key, so there are no conflicts.
+	var next int64
+	commit := func(b *testing.B) {
+		k := benchKey(benchKeys + int(atomic.AddInt64(&next, 1)))
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(k, []byte("value"))
+			return nil, nil
+		})
+		if err != nil {
+			b.Errorf("Transact failed: %v", err)
+		}
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			commit(b)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				commit(b)
+			}
+		})
+	})
+}
+
+func BenchmarkTransactionBulkLoad(b *testing.B) {
+	db, err := OpenDefault()
+	if err != nil {
+		b.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	// Each iteration writes benchKeys keys in one transaction.
+	for i := 0; i < b.N; i++ {
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			for j := 0; j < benchKeys; j++ {
+				tx.Set(benchKey(j), []byte("value"))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			b.Fatalf("Transact failed: %v", err)
+		}
+	}
+}
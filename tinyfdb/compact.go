@@ -0,0 +1,137 @@
+package tinyfdb
+
+import "bytes"
+
+// A compactEntry is a key that got a new version in a commit. Once
+// no reader can see older versions, they can be removed.
+type compactEntry struct {
+	key Key
+	seq uint64
+}
+
+// Compact removes all versions that no live transaction can read. A
+// transaction that later sets an older read version fails with
+// transaction_too_old. Commits compact incrementally, but only
+// versions older than the MVCC window, so tests can use this to
+// compact immediately.
+func (d *DBDebug) Compact() {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.advanceVersionLocked()
+	h := dd.compactionHorizonLocked(false)
+
+	var old []keyValue
+	var prev *keyValue
+	dd.bt.Ascend(nil, func(item interface{}) bool {
+		kv := item.(keyValue)
+		if kv.Seq > h {
+			return true
+		}
+		// A version is old if a newer one is visible at h. A
+		// tombstone is only needed to hide older versions.
+		if prev != nil && (bytes.Equal(prev.Key, kv.Key) || isTombstone(*prev)) {
+			old = append(old, *prev)
+		}
+		prev = &kv
+		return true
+	})
+	if prev != nil && isTombstone(*prev) {
+		old = append(old, *prev)
+	}
+	for _, kv := range old {
+		dd.bt.Delete(kv)
+	}
+
+	dd.dropCompactQueueLocked(h)
+	dd.setOldestSeqLocked(h)
+}
+
+// enqueueCompactionLocked remembers that the key got a new version.
+func (d *database) enqueueCompactionLocked(k Key, seq uint64) {
+	d.compactQueue = append(d.compactQueue, compactEntry{k, seq})
+}
+
+// compactLocked removes old versions of keys that got new versions in
+// commits that are now outside the MVCC window, and not visible to any
+// live transaction.
+func (d *database) compactLocked() {
+	h := d.compactionHorizonLocked(true)
+
+	n := 0
+	for _, e := range d.compactQueue {
+		// The queue is ordered by seq, since commits are.
+		if e.seq > h {
+			break
+		}
+		d.compactKeyLocked(e.key, h)
+		n++
+	}
+	if n > 0 {
+		d.dropCompactQueueLocked(h)
+		d.setOldestSeqLocked(h)
+	}
+}
+
+// compactKeyLocked removes the versions of the key that are not
+// visible at or after h.
+func (d *database) compactKeyLocked(k Key, h uint64) {
+	var old []keyValue
+	d.bt.Descend(keyValue{Key: k, Seq: h}, func(item interface{}) bool {
+		kv := item.(keyValue)
+		if !bytes.Equal(kv.Key, k) {
+			return false
+		}
+		old = append(old, kv)
+		return true
+	})
+
+	// The first is the version visible at h. A tombstone is only
+	// needed to hide older versions.
+	if len(old) > 0 && !isTombstone(old[0]) {
+		old = old[1:]
+	}
+	for _, kv := range old {
+		d.bt.Delete(kv)
+	}
+}
+
+// compactionHorizonLocked returns the oldest version that must stay
+// readable. It is the oldest read version of live transactions, or
+// the latest version. If window is true, it is also inside the MVCC
+// window, since new transactions can use SetReadVersion. Transactions
+// that are already too old can't read, and are ignored.
+func (d *database) compactionHorizonLocked(window bool) uint64 {
+	h := d.prevSeq
+	if window {
+		if h <= mvccWindowVersions {
+			return 0
+		}
+		h -= mvccWindowVersions
+	}
+	for t := range d.txmap {
+		if t.readSeq != 0 && t.readSeq < h && !d.tooOldLocked(t.readSeq) {
+			h = t.readSeq
+		}
+	}
+	return h
+}
+
+// dropCompactQueueLocked forgets queued keys with versions at or
+// before h.
+func (d *database) dropCompactQueueLocked(h uint64) {
+	i := 0
+	for i < len(d.compactQueue) && d.compactQueue[i].seq <= h {
+		i++
+	}
+	d.compactQueue = append(d.compactQueue[:0], d.compactQueue[i:]...)
+}
+
+// setOldestSeqLocked records that versions before h may have been
+// compacted.
+func (d *database) setOldestSeqLocked(h uint64) {
+	if h > d.oldestSeq {
+		d.oldestSeq = h
+	}
+}
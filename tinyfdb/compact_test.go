@@ -0,0 +1,156 @@
+package tinyfdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDBDebugCompact(t *testing.T) {
+	// versions returns all versions in the database.
+	versions := func(db Database) []string {
+		var got []string
+		db.bt.Ascend(nil, func(item interface{}) bool {
+			kv := item.(keyValue)
+			got = append(got, string(kv.Key)+"="+string(kv.Value))
+			return true
+		})
+		return got
+	}
+
+	t.Run("removesOldVersions", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+		commitValue(t, db, Key("akey"), []byte("anewvalue"))
+		commitValue(t, db, Key("bkey"), []byte("bvalue"))
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Clear(Key("bkey"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		db.Debug().Compact()
+
+		if got, want := versions(db), []string{"akey=anewvalue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Compact: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("keepsLiveReadVersion", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.GetReadVersion().MustGet()
+
+		commitValue(t, db, Key("akey"), []byte("anewvalue"))
+		db.Debug().Compact()
+
+		if got := tx.Get(Key("akey")).MustGet(); string(got) != "avalue" {
+			t.Errorf("Get: got %q, want %q", got, "avalue")
+		}
+
+		tx.Cancel()
+		db.Debug().Compact()
+
+		if got, want := versions(db), []string{"akey=anewvalue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Compact: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("tooOld", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		v := commitValue(t, db, Key("akey"), []byte("avalue"))
+		commitValue(t, db, Key("akey"), []byte("anewvalue"))
+		db.Debug().Compact()
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.SetReadVersion(v)
+
+		if _, err := tx.Get(Key("akey")).Get(); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionTooOld)
+		}
+	})
+
+	t.Run("ignoresTooOldTransaction", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		now := time.Unix(1000, 0)
+		db.Debug().SetClock(func() time.Time { return now })
+
+		// An abandoned transaction, which is never cancelled.
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Get(Key("akey")).MustGet()
+
+		for i := 0; i < 10; i++ {
+			now = now.Add(time.Second)
+			commitValue(t, db, Key("akey"), []byte(fmt.Sprint("avalue", i)))
+		}
+		db.Debug().Compact()
+
+		if got, want := versions(db), []string{"akey=avalue9"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Compact: got %q, want %q", got, want)
+		}
+		if got := len(db.commits); got != 0 {
+			t.Errorf("commits: got %v, want 0", got)
+		}
+	})
+
+	t.Run("onCommit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		now := time.Unix(1000, 0)
+		db.Debug().SetClock(func() time.Time { return now })
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+		commitValue(t, db, Key("akey"), []byte("anewvalue"))
+		commitValue(t, db, Key("bkey"), []byte("bvalue"))
+
+		// Inside the MVCC window.
+		now = now.Add(4 * time.Second)
+		commitValue(t, db, Key("ckey"), []byte("cvalue"))
+		if got, want := versions(db), []string{"akey=avalue", "akey=anewvalue", "bkey=bvalue", "ckey=cvalue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("versions: got %q, want %q", got, want)
+		}
+
+		now = now.Add(2 * time.Second)
+		commitValue(t, db, Key("ckey"), []byte("cnewvalue"))
+		if got, want := versions(db), []string{"akey=anewvalue", "bkey=bvalue", "ckey=cvalue", "ckey=cnewvalue"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("versions: got %q, want %q", got, want)
+		}
+		if got, want := len(db.compactQueue), 2; got != want {
+			t.Errorf("compactQueue: got %v, want %v", got, want)
+		}
+	})
+}
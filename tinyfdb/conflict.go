@@ -0,0 +1,218 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
+)
+
+// A commitRecord holds the write conflict ranges of a committed
+// transaction. It is kept as long as there are live transactions
+// with earlier read versions, since they conflict if they read any
+// of the keys.
+type commitRecord struct {
+	seq    uint64
+	writes rangeSet
+	stacks []conflictStack
+}
+
+// A conflictStack is where a conflict range was added. Only recorded
+// if race stacks are printed.
+type conflictStack struct {
+	r     keyRange
+	typ   string
+	stack string
+}
+
+// keyAfter returns the first key after k.
+func keyAfter(k Key) Key {
+	return append(k[:len(k):len(k)], 0)
+}
+
+// AddReadConflictRange adds a range of keys to the transaction's
+// read conflict ranges as if you had read the range. As a result,
+// other transactions that write a key in this range could cause the
+// transaction to fail with a conflict. The keys need not exist.
+func (t *transaction) AddReadConflictRange(er ExactRange) error {
+	b, e, err := conflictRangeKeys(er)
+	if err != nil {
+		return err
+	}
+	t.addReadConflictRange(b, e)
+	return nil
+}
+
+// AddReadConflictKey adds a key to the transaction's read conflict
+// ranges as if you had read the key. As a result, other transactions
+// that concurrently write this key could cause the transaction to
+// fail with a conflict.
+func (t *transaction) AddReadConflictKey(key KeyConvertible) error {
+	k := key.FDBKey()
+	t.addReadConflictRange(k, keyAfter(k))
+	return nil
+}
+
+// AddWriteConflictRange adds a range of keys to the transaction's
+// write conflict ranges as if you had cleared the range. As a result,
+// other transactions that concurrently read a key in this range could
+// fail with a conflict. Unlike ClearRange, no keys are changed.
+func (t *transaction) AddWriteConflictRange(er ExactRange) error {
+	b, e, err := conflictRangeKeys(er)
+	if err != nil {
+		return err
+	}
+	if err := t.writeErr(); err != nil {
+		return err
+	}
+	t.addWriteConflictRange(b, e)
+	return nil
+}
+
+// AddWriteConflictKey adds a key to the transaction's write conflict
+// ranges as if you had written the key. As a result, other
+// transactions that concurrently read this key could fail with a
+// conflict.
+func (t *transaction) AddWriteConflictKey(key KeyConvertible) error {
+	k := key.FDBKey()
+	if err := t.writeErr(); err != nil {
+		return err
+	}
+	t.addWriteConflictRange(k, keyAfter(k))
+	return nil
+}
+
+// writeErr returns an error if the transaction can't be modified.
+func (t *transaction) writeErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.writeErrLocked()
+}
+
+// conflictRangeKeys returns the keys of an explicit conflict range.
+func conflictRangeKeys(er ExactRange) (Key, Key, error) {
+	b, e := er.FDBRangeKeys()
+	bk, ek := b.FDBKey(), e.FDBKey()
+	if bytes.Compare(bk, ek) > 0 {
+		return nil, nil, errInvertedRange
+	}
+	return bk, ek, nil
+}
+
+// addReadConflictRange adds [b, e) to the ranges that cause the
+// transaction to fail if another transaction writes to them after
+// our read version.
+func (t *transaction) addReadConflictRange(b, e Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.addConflictRangeLocked(&t.readConflicts, "read", b, e, 1)
+}
+
+// addWriteConflictRange adds [b, e) to the ranges that cause other
+// transactions to fail if they have read them.
+func (t *transaction) addWriteConflictRange(b, e Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.addConflictRangeLocked(&t.writeConflicts, "write", b, e, 1)
+}
+
+func (t *transaction) addConflictRangeLocked(rs *rangeSet, typ string, b, e Key, stackSkip int) {
+	b = append(Key(nil), b...)
+	e = append(Key(nil), e...)
+	rs.Add(b, e)
+
+	if t.recordStacks {
+		t.conflictStacks = append(t.conflictStacks, conflictStack{keyRange{b, e}, typ, stackTrace(1 + stackSkip)})
+	}
+}
+
+// checkConflictsLocked returns an error if any transaction committed
+// after our read version wrote to a key we have read.
+func (t *transaction) checkConflictsLocked() error {
+	if len(t.readConflicts) == 0 {
+		return nil
+	}
+	if t.readSeq < t.d.forgotSeq {
+		// A read version set with SetReadVersion may predate the
+		// records we still have.
+		return errTransactionTooOld
+	}
+
+	for _, c := range t.d.commits {
+		if c.seq <= t.readSeq || !c.writes.Intersects(t.readConflicts) {
+			continue
+		}
+
+		if t.d.raceStacks != nil {
+			for _, r := range t.readConflicts {
+				if !c.writes.IntersectsRange(r.Begin, r.End) {
+					continue
+				}
+				fmt.Fprintf(t.d.raceStacks, "*** TinyFDB Races for keys %s ***\n", formatKeyRange(r))
+				for _, s := range append(append([]conflictStack(nil), t.conflictStacks...), c.stacks...) {
+					if bytes.Compare(s.r.Begin, r.End) < 0 && bytes.Compare(r.Begin, s.r.End) < 0 {
+						fmt.Fprintln(t.d.raceStacks, "Race", s.typ, "in", s.stack)
+					}
+				}
+			}
+		}
+
+		return errNotCommitted
+	}
+
+	return nil
+}
+
+// recordCommitLocked remembers the write conflict ranges of the
+// transaction, committed at seq, and forgets records that can no
+// longer cause conflicts.
+func (t *transaction) recordCommitLocked(seq uint64) {
+	// Transactions without a read version will get one at or after
+	// seq. Transactions that are already too old will fail to
+	// commit without checking conflicts.
+	minSeq := seq
+	for t2 := range t.d.txmap {
+		if t2 != t && t2.readSeq != 0 && t2.readSeq < minSeq && !t.d.tooOldLocked(t2.readSeq) {
+			minSeq = t2.readSeq
+		}
+	}
+
+	commits := t.d.commits[:0]
+	for _, c := range t.d.commits {
+		if c.seq > minSeq {
+			commits = append(commits, c)
+		}
+	}
+	for i := len(commits); i < len(t.d.commits); i++ {
+		t.d.commits[i] = commitRecord{}
+	}
+	t.d.commits = commits
+	if minSeq > t.d.forgotSeq {
+		t.d.forgotSeq = minSeq
+	}
+
+	if len(t.writeConflicts) > 0 && seq > minSeq {
+		var stacks []conflictStack
+		for _, s := range t.conflictStacks {
+			if s.typ == "write" {
+				stacks = append(stacks, s)
+			}
+		}
+		t.d.commits = append(t.d.commits, commitRecord{seq: seq, writes: t.writeConflicts, stacks: stacks})
+	}
+}
+
+// formatKeyRange returns a human-readable form of the range. Tuple
+// keys are unpacked.
+func formatKeyRange(r keyRange) string {
+	format := func(k Key) interface{} {
+		if kt, err := internal.UnpackTuple(k); err == nil {
+			return kt
+		}
+		return k
+	}
+	return fmt.Sprintf("%+v - %+v", format(r.Begin), format(r.End))
+}
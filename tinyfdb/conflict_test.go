@@ -0,0 +1,153 @@
+package tinyfdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransactionAddConflictRange(t *testing.T) {
+	tsts := []struct {
+		Name string
+		// Reader runs in the transaction that is checked for
+		// conflicts.
+		Reader func(Transaction) error
+		// Writer runs in a transaction that commits after the
+		// reader's read version.
+		Writer  func(Transaction) error
+		WantErr error
+	}{
+		{
+			Name:   "readRange",
+			Reader: func(tx Transaction) error { return tx.AddReadConflictRange(KeyRange{Key("a"), Key("c")}) },
+			Writer: func(tx Transaction) error {
+				tx.Set(Key("bkey"), []byte("bvalue"))
+				return nil
+			},
+			WantErr: errNotCommitted,
+		},
+		{
+			Name:   "readRangeOutside",
+			Reader: func(tx Transaction) error { return tx.AddReadConflictRange(KeyRange{Key("a"), Key("b")}) },
+			Writer: func(tx Transaction) error {
+				tx.Set(Key("bkey"), []byte("bvalue"))
+				return nil
+			},
+		},
+		{
+			Name:   "readKey",
+			Reader: func(tx Transaction) error { return tx.AddReadConflictKey(Key("bkey")) },
+			Writer: func(tx Transaction) error {
+				tx.Set(Key("bkey"), []byte("bvalue"))
+				return nil
+			},
+			WantErr: errNotCommitted,
+		},
+		{
+			Name:   "readKeyNotPrefix",
+			Reader: func(tx Transaction) error { return tx.AddReadConflictKey(Key("bkey")) },
+			Writer: func(tx Transaction) error {
+				tx.Set(Key("bkey2"), []byte("bvalue"))
+				return nil
+			},
+		},
+		{
+			Name: "writeRange",
+			Reader: func(tx Transaction) error {
+				_, err := tx.Get(Key("bkey")).Get()
+				return err
+			},
+			Writer:  func(tx Transaction) error { return tx.AddWriteConflictRange(KeyRange{Key("a"), Key("c")}) },
+			WantErr: errNotCommitted,
+		},
+		{
+			Name: "writeKey",
+			Reader: func(tx Transaction) error {
+				_, err := tx.Get(Key("bkey")).Get()
+				return err
+			},
+			Writer:  func(tx Transaction) error { return tx.AddWriteConflictKey(Key("bkey")) },
+			WantErr: errNotCommitted,
+		},
+		{
+			Name: "writeKeyOther",
+			Reader: func(tx Transaction) error {
+				_, err := tx.Get(Key("bkey")).Get()
+				return err
+			},
+			Writer: func(tx Transaction) error { return tx.AddWriteConflictKey(Key("ckey")) },
+		},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			tx.GetReadVersion().MustGet()
+			if err := tst.Reader(tx); err != nil {
+				t.Fatalf("Reader failed: %v", err)
+			}
+			tx.Set(Key("xkey"), []byte("xvalue"))
+
+			if _, err := db.Transact(func(tx Transaction) (interface{}, error) { return nil, tst.Writer(tx) }); err != nil {
+				t.Fatalf("Transact(Writer) failed: %v", err)
+			}
+
+			if err := tx.Commit().Get(); !errors.Is(err, tst.WantErr) {
+				t.Errorf("Commit err: got %v, want %v", err, tst.WantErr)
+			}
+		})
+	}
+
+	t.Run("invertedRange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		r := KeyRange{Key("b"), Key("a")}
+		if err := tx.AddReadConflictRange(r); !errors.Is(err, errInvertedRange) {
+			t.Errorf("AddReadConflictRange err: got %v, want %v", err, errInvertedRange)
+		}
+		if err := tx.AddWriteConflictRange(r); !errors.Is(err, errInvertedRange) {
+			t.Errorf("AddWriteConflictRange err: got %v, want %v", err, errInvertedRange)
+		}
+	})
+
+	t.Run("writeOnlyCommits", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.AddWriteConflictKey(Key("akey")); err != nil {
+			t.Fatalf("AddWriteConflictKey failed: %v", err)
+		}
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		// Only conflict ranges were written, but it's not a
+		// read-only transaction.
+		if got, err := tx.GetCommittedVersion(); err != nil || got <= 0 {
+			t.Errorf("GetCommittedVersion: got %v, %v, want > 0", got, err)
+		}
+		if got := db.bt.Len(); got != 0 {
+			t.Errorf("Len: got %v, want 0", got)
+		}
+	})
+}
@@ -1,13 +1,14 @@
 package tinyfdb
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
 	"io"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/tidwall/btree"
-	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
 )
 
 type Database struct {
@@ -31,46 +32,130 @@ func (d Database) CreateTransaction() (Transaction, error) {
 	return d.database.CreateTransaction()
 }
 
-func (d Database) Transact(f func(Transaction) (interface{}, error)) (_ interface{}, rerr error) {
+// Transact runs f in a transaction and commits it. If f or the
+// commit fails with a retryable error, the transaction is reset using
+// `Transaction.OnError`, and f is called again. An Error panic in f,
+// e.g. from MustGet, is returned as an error.
+func (d Database) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	tx, err := d.database.CreateTransaction()
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if rerr == nil {
-			rerr = tx.Commit().Get()
+
+	return retryable(tx, func() (ret interface{}, err error) {
+		defer panicToError(&err)
+
+		ret, err = f(tx)
+		if err == nil {
+			err = tx.Commit().Get()
 		}
-		if rerr != nil {
+		return
+	})
+}
+
+// ReadTransact runs f in a transaction, like Transact, but never
+// commits it. The transaction is cancelled once f succeeds.
+func (d Database) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	tx, err := d.database.CreateTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	return retryable(tx, func() (ret interface{}, err error) {
+		defer panicToError(&err)
+
+		ret, err = f(tx)
+		if err == nil {
 			tx.Cancel()
 		}
-	}()
+		return
+	})
+}
 
-	for i := 0; ; i++ {
-		v, err := f(tx)
+// retryable calls f until it succeeds, or fails with an error that
+// `Transaction.OnError` doesn't consider retryable. The error from
+// OnError is returned, e.g. transaction_timed_out. The transaction is
+// cancelled on failure.
+func retryable(tx Transaction, f func() (interface{}, error)) (interface{}, error) {
+	for {
+		v, err := f()
 		if err == nil {
 			return v, nil
 		}
 
-		var rerr RetryableError
-		if i == maxTransactRetries-1 || !errors.As(err, &rerr) {
-			return nil, err
+		var ferr Error
+		wrapped := false
+		if !errors.As(err, &ferr) {
+			if !errors.Is(err, RetryableError{}) {
+				tx.Cancel()
+				return nil, err
+			}
+			// Retried like a conflict.
+			ferr = errNotCommitted
+			wrapped = true
+		}
+		if oerr := tx.OnError(ferr).Get(); oerr != nil {
+			tx.Cancel()
+			if wrapped && errors.Is(oerr, ferr) {
+				// Out of retries. Return the caller's error.
+				return nil, err
+			}
+			return nil, oerr
 		}
 	}
 }
 
-const maxTransactRetries = 10
+// panicToError recovers an Error panic, and stores it in e. Other
+// panics are propagated.
+func panicToError(e *error) {
+	if r := recover(); r != nil {
+		ferr, ok := r.(Error)
+		if !ok {
+			panic(r)
+		}
+		*e = ferr
+	}
+}
+
+var (
+	_ Transactor = Database{}
+	_ Transactor = Transaction{}
+)
 
 type database struct {
-	mu         sync.Mutex
-	bt         *btree.BTree // keyValue
-	txmap      map[*transaction]struct{}
-	prevSeq    uint64
-	raceStacks io.Writer
+	mu           sync.Mutex
+	bt           *btree.BTree // keyValue. Readers use snapshotLocked.
+	txmap        map[*transaction]struct{}
+	prevSeq      uint64 // The latest version. At least the latest commit version.
+	epoch        time.Time
+	now          func() time.Time
+	commits      []commitRecord // Ordered by seq.
+	forgotSeq    uint64         // Commit records up to this version have been pruned.
+	oldestSeq    uint64         // Older versions may have been compacted.
+	compactQueue []compactEntry // Ordered by seq.
+	watches      map[*watch]struct{}
+	maxWatches   int
+	txOptions    transactionOptions // Defaults for new transactions.
+	raceStacks   io.Writer
+
+	synchronousFutures bool // Futures are ready when returned.
+	latencies          map[DebugOperation]LatencyFunc
+	rnd                *rand.Rand
+	randomOrder        bool       // Queue operations instead of starting goroutines.
+	queue              []queuedOp // Operations waiting to run in random order.
+	rangeBatches       RangeBatchStats
 }
 
+// A keyValue is one version of a key. Versions of the same key are
+// ordered by their sequence numbers. A nil Value is a tombstone.
 type keyValue struct {
-	Key   internal.Tuple
+	Key   Key
+	Seq   uint64
 	Value []byte
+
+	// Ops are deferred mutations of the latest committed value. Only
+	// used in `transaction.writes`, and Value is unused if non-nil.
+	Ops []mutation
 }
 
 func newDatabase() *database {
@@ -78,29 +163,83 @@ func newDatabase() *database {
 		bt:         btree.NewNonConcurrent(btreeBefore),
 		txmap:      map[*transaction]struct{}{},
 		prevSeq:    1,
+		epoch:      time.Now(),
+		now:        time.Now,
+		watches:    map[*watch]struct{}{},
+		maxWatches: defaultMaxWatches,
+		txOptions:  defaultTransactionOptions(),
 		raceStacks: defaultPrintRaceStacks(),
+		latencies:  map[DebugOperation]LatencyFunc{},
+		rnd:        rand.New(rand.NewSource(1)),
 	}
 }
 
+// btreeBefore orders keys lexicographically by bytes, like
+// FoundationDB, and then versions by sequence number.
 func btreeBefore(a, b interface{}) bool {
-	aa := toKey(a)
-	bb := toKey(b)
+	aa := a.(keyValue)
+	bb := b.(keyValue)
 
-	v, err := aa.Cmp(bb)
-	if err != nil {
-		panic(err)
+	if c := bytes.Compare(aa.Key, bb.Key); c != 0 {
+		return c < 0
 	}
-	return v < 0
+	return aa.Seq < bb.Seq
 }
 
-func toKey(v interface{}) internal.Tuple {
-	if vv, ok := v.(internal.Tuple); ok {
-		return vv
-	}
-	if kv, ok := v.(keyValue); ok {
-		return kv.Key
+// snapshotLocked returns an immutable copy of the committed versions.
+// Copying is cheap, since nodes are shared until they are modified.
+func (d *database) snapshotLocked() *btree.BTree {
+	return d.bt.Copy()
+}
+
+// clock returns the current time of the database clock.
+func (d *database) clock() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.now()
+}
+
+// latestLocked returns the latest committed value of the key, or nil
+// if it doesn't exist.
+func (d *database) latestLocked(k Key) []byte {
+	kv, ok := btreePrev(d.bt, keyValue{Key: k, Seq: pendingSeq}, true)
+	if !ok || !bytes.Equal(kv.Key, k) {
+		return nil
 	}
-	panic(fmt.Errorf("unknown key type: %T", v))
+	return kv.Value
+}
+
+// btreeNext returns the first item at or after (if inclusive) the
+// pivot.
+func btreeNext(bt *btree.BTree, pivot keyValue, inclusive bool) (keyValue, bool) {
+	var found keyValue
+	var ok bool
+	bt.Ascend(pivot, func(item interface{}) bool {
+		if !inclusive && !btreeBefore(pivot, item) {
+			return true
+		}
+		found = item.(keyValue)
+		ok = true
+		return false
+	})
+	return found, ok
+}
+
+// btreePrev returns the last item at or before (if inclusive) the
+// pivot.
+func btreePrev(bt *btree.BTree, pivot keyValue, inclusive bool) (keyValue, bool) {
+	var found keyValue
+	var ok bool
+	bt.Descend(pivot, func(item interface{}) bool {
+		if !inclusive && !btreeBefore(item, pivot) {
+			return true
+		}
+		found = item.(keyValue)
+		ok = true
+		return false
+	})
+	return found, ok
 }
 
 func (d *database) CreateTransaction() (Transaction, error) {
@@ -1,8 +1,10 @@
 package tinyfdb
 
 import (
+	"bytes"
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestOpenDefault(t *testing.T) {
@@ -91,8 +93,185 @@ func TestDatabaseTransact(t *testing.T) {
 			t.Fatalf("Transact err: got %v, want %v", err, wantErr)
 		}
 
-		if want := maxTransactRetries; i != want {
+		if want := defaultRetryLimit + 1; i != want {
 			t.Errorf("Transact i: got %v, want %v", i, want)
 		}
 	})
+
+	t.Run("retriesCommitConflict", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		var i int
+		got, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			v, err := tx.Get(Key("akey")).Get()
+			if err != nil {
+				return nil, err
+			}
+			tx.Set(Key("bkey"), v)
+
+			if i == 1 {
+				// Makes the first commit fail.
+				_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+					tx.Set(Key("akey"), []byte("avalue"))
+					return nil, nil
+				})
+				if err != nil {
+					t.Fatalf("Transact(inner) failed: %v", err)
+				}
+			}
+			return string(v), nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if want := 2; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+		// The retry must see the new value.
+		if want := "avalue"; got != want {
+			t.Errorf("Transact: got %q, want %q", got, want)
+		}
+	})
+	t.Run("retriesPanic", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		var i int
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			if i == 1 {
+				panic(errNotCommitted)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if want := 2; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+
+	t.Run("failNotRetryableError", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		var i int
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			return nil, errTransactionCancelled
+		})
+		if !errors.Is(err, errTransactionCancelled) {
+			t.Fatalf("Transact err: got %v, want %v", err, errTransactionCancelled)
+		}
+
+		if want := 1; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+}
+
+func TestDatabaseReadTransact(t *testing.T) {
+	t.Run("returnsValue", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key("akey"), Seq: 1, Value: []byte("avalue")})
+
+		got, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			return tx.Get(Key("akey")).MustGet(), nil
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+
+		if want := []byte("avalue"); !bytes.Equal(got.([]byte), want) {
+			t.Errorf("ReadTransact: got %q, want %q", got, want)
+		}
+		if len(db.txmap) != 0 {
+			t.Errorf("txmap: transaction not unregistered: %v", db.txmap)
+		}
+	})
+
+	t.Run("neverCommits", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		_, err = db.ReadTransact(func(rtx ReadTransaction) (interface{}, error) {
+			// Writes are possible through the concrete type, but
+			// are discarded.
+			rtx.(Transaction).Set(Key("akey"), []byte("avalue"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+
+		if got := db.bt.Len(); got != 0 {
+			t.Errorf("Len: got %v, want 0", got)
+		}
+	})
+}
+
+func TestTransactorComposition(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	setKey := func(tr Transactor) error {
+		_, err := tr.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key("akey"), []byte("avalue"))
+			return nil, nil
+		})
+		return err
+	}
+	getKey := func(tr ReadTransactor) ([]byte, error) {
+		v, err := tr.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			return tx.Get(Key("akey")).MustGet(), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.([]byte), nil
+	}
+
+	_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+		if err := setKey(tx); err != nil {
+			return nil, err
+		}
+		// Runs inline, so it sees the write.
+		return getKey(tx.Snapshot())
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	got, err := getKey(db)
+	if err != nil {
+		t.Fatalf("getKey failed: %v", err)
+	}
+	if want := []byte("avalue"); !bytes.Equal(got, want) {
+		t.Errorf("getKey: got %q, want %q", got, want)
+	}
+}
+
+// freezeClock stops the database clock, so commit versions increase
+// by one. Tests can then predict sequence numbers.
+func freezeClock(db Database) {
+	db.now = func() time.Time { return db.epoch }
 }
@@ -3,10 +3,14 @@ package tinyfdb
 import (
 	"io"
 	"os"
+	"time"
 )
 
 type DBDebug database
 
+// PrintRaceStacks makes conflicts print the stacks where the
+// conflicting ranges were read and written. Only transactions created
+// or reset afterwards record stacks.
 func (d *DBDebug) PrintRaceStacks(w io.Writer) {
 	dd := (*database)(d)
 	dd.mu.Lock()
@@ -14,6 +18,31 @@ func (d *DBDebug) PrintRaceStacks(w io.Writer) {
 	dd.mu.Unlock()
 }
 
+// SetClock replaces the clock the database uses for versions, the
+// MVCC window and timeouts. This allows tests to trigger
+// transaction_too_old deterministically. Versions continue from the
+// current version.
+func (d *DBDebug) SetClock(now func() time.Time) {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	el := dd.now().Sub(dd.epoch)
+	dd.now = now
+	dd.epoch = now().Add(-el)
+}
+
+// SetSynchronousFutures makes operations complete before their
+// futures are returned, instead of on goroutines. This makes
+// execution deterministic, which can help when debugging.
+func (d *DBDebug) SetSynchronousFutures(enabled bool) {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.synchronousFutures = enabled
+}
+
 func defaultPrintRaceStacks() io.Writer {
 	if os.Getenv("TINYFDB_RACE_TRACEBACK") != "" {
 		return os.Stderr
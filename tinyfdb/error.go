@@ -1,8 +1,120 @@
 package tinyfdb
 
+import "fmt"
+
+// Error represents a low-level error returned by the database. The
+// codes and descriptions are the same as in FoundationDB. See
+// https://apple.github.io/foundationdb/api-error-codes.html.
+//
+// Generally, an Error should be passed to (Transaction).OnError. When
+// using (Database).Transact, non-fatal errors will be retried
+// automatically.
+type Error struct {
+	Code int
+}
+
+func (e Error) Error() string {
+	desc, ok := errorDescriptions[e.Code]
+	if !ok {
+		desc = "UNKNOWN_ERROR"
+	}
+	return fmt.Sprintf("FoundationDB error code %d (%s)", e.Code, desc)
+}
+
+// Is makes retryable errors match RetryableError, for compatibility.
+func (e Error) Is(err error) bool {
+	_, ok := err.(RetryableError)
+	return ok && e.retryable()
+}
+
+// retryable returns whether OnError resets the transaction for a
+// retry, rather than failing.
+func (e Error) retryable() bool {
+	switch e {
+	case errTransactionTooOld, errFutureVersion, errNotCommitted, errCommitUnknownResult, errProcessBehind, errDatabaseLocked:
+		return true
+	default:
+		return false
+	}
+}
+
+// Errors returned by this package.
+var (
+	errTransactionTooOld      = Error{1007}
+	errFutureVersion          = Error{1009}
+	errNotCommitted           = Error{1020}
+	errCommitUnknownResult    = Error{1021}
+	errTransactionCancelled   = Error{1025}
+	errTransactionTimedOut    = Error{1031}
+	errTooManyWatches         = Error{1032}
+	errWatchesDisabled        = Error{1034}
+	errAccessedUnreadable     = Error{1036}
+	errProcessBehind          = Error{1037}
+	errDatabaseLocked         = Error{1038}
+	errOperationCancelled     = Error{1101}
+	errClientInvalidOperation = Error{2000}
+	errKeyOutsideLegalRange   = Error{2004}
+	errInvertedRange          = Error{2005}
+	errInvalidOptionValue     = Error{2006}
+	errUsedDuringCommit       = Error{2017}
+	errReadVersionAlreadySet  = Error{2010}
+	errVersionInvalid         = Error{2011}
+	errNoCommitVersion        = Error{2021}
+	errExactModeWithoutLimits = Error{2210}
+	errTransactionTooLarge    = Error{2101}
+	errKeyTooLarge            = Error{2102}
+	errValueTooLarge          = Error{2103}
+)
+
+// errorDescriptions are the FoundationDB descriptions of error codes.
+var errorDescriptions = map[int]string{
+	1000: "Operation failed",
+	1004: "Operation timed out",
+	1007: "Transaction is too old to perform reads or be committed",
+	1009: "Request for future version",
+	1020: "Transaction not committed due to conflict with another transaction",
+	1021: "Transaction may or may not have committed",
+	1025: "Operation aborted because the transaction was cancelled",
+	1031: "Operation aborted because the transaction timed out",
+	1032: "Too many watches currently set",
+	1034: "Watches cannot be set if read your writes is disabled",
+	1036: "Read or wrote an unreadable key",
+	1037: "Storage process does not have recent mutations",
+	1038: "Database is locked",
+	1101: "Asynchronous operation cancelled",
+	1102: "Future has been released",
+	2000: "Invalid API call",
+	2004: "Key outside legal range",
+	2005: "Range begin key larger than end key",
+	2006: "Option set with an invalid value",
+	2007: "Option not valid in this context",
+	2010: "Transaction already has a read version set",
+	2011: "Version not valid",
+	2012: "Range limits not valid",
+	2015: "Future not ready",
+	2017: "Operation issued while a commit was outstanding",
+	2018: "Unrecognized atomic mutation type",
+	2020: "Transaction does not have a valid commit version",
+	2021: "Transaction is read-only and therefore does not have a commit version",
+	2024: "Attempted to commit a transaction specified as read-only",
+	2101: "Transaction exceeds byte limit",
+	2102: "Key length exceeds limit",
+	2103: "Value length exceeds limit",
+	2200: "API version is not set",
+	2201: "API version may be set only once",
+	2202: "API version not valid",
+	2203: "API version not supported",
+	2210: "EXACT streaming mode requires limits, but none were given",
+	4000: "An unknown error occurred",
+	4100: "An internal error occurred",
+}
+
 // A RetryableError is a wrapper for an error the database code
 // considers temporary. Usually a conflicting transaction, which means
 // that retrying will likely succeed.
+//
+// This is a tinyfdb extension. The database returns Error, but
+// Transact also retries functions that return a RetryableError.
 type RetryableError struct {
 	Err error
 }
@@ -0,0 +1,36 @@
+package tinyfdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tsts := []struct {
+		Name string
+		Err  Error
+
+		WantString    string
+		WantRetryable bool
+	}{
+		{"notCommitted", Error{1020}, "FoundationDB error code 1020 (Transaction not committed due to conflict with another transaction)", true},
+		{"transactionCancelled", Error{1025}, "FoundationDB error code 1025 (Operation aborted because the transaction was cancelled)", false},
+		{"unknown", Error{42}, "FoundationDB error code 42 (UNKNOWN_ERROR)", false},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			if got := tst.Err.Error(); got != tst.WantString {
+				t.Errorf("Error: got %q, want %q", got, tst.WantString)
+			}
+
+			if got := errors.Is(tst.Err, RetryableError{}); got != tst.WantRetryable {
+				t.Errorf("Is(RetryableError): got %v, want %v", got, tst.WantRetryable)
+			}
+
+			var got Error
+			if !errors.As(RetryableError{tst.Err}, &got) || got != tst.Err {
+				t.Errorf("As: got %v, want %v", got, tst.Err)
+			}
+		})
+	}
+}
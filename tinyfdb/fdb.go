@@ -16,7 +16,11 @@
  */
 package tinyfdb
 
-import "github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
+import (
+	"fmt"
+
+	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
+)
 
 type ExactRange interface {
 	// FDBRangeKeys returns a pair of keys that describe the beginning and end
@@ -66,6 +70,20 @@ type FutureByteSlice interface {
 	Future
 }
 
+type FutureKey interface {
+	// Get returns a database key or an error if the asynchronous operation
+	// associated with this future did not successfully complete. The current
+	// goroutine will be blocked until the future is ready.
+	Get() (Key, error)
+
+	// MustGet returns a database key, or panics if the asynchronous operation
+	// associated with this future did not successfully complete. The current
+	// goroutine will be blocked until the future is ready.
+	MustGet() Key
+
+	Future
+}
+
 type FutureInt64 interface {
 	// Get returns a database version or an error if the asynchronous operation
 	// associated with this future did not successfully complete. The current
@@ -159,6 +177,23 @@ type KeyValue struct {
 	Value []byte
 }
 
+// PrefixRange returns the KeyRange describing the range of keys k such that
+// bytes.HasPrefix(k, prefix) is true. PrefixRange returns an error if prefix is
+// empty or entirely 0xFF bytes.
+//
+// Do not use PrefixRange on objects that already implement the Range or
+// ExactRange interfaces. The prefix range of the byte representation of these
+// objects may not correspond to their logical range.
+func PrefixRange(prefix []byte) (KeyRange, error) {
+	begin := make([]byte, len(prefix))
+	copy(begin, prefix)
+	end, err := Strinc(begin)
+	if err != nil {
+		return KeyRange{}, err
+	}
+	return KeyRange{Key(begin), Key(end)}, nil
+}
+
 type Range interface {
 	// FDBRangeKeySelectors returns a pair of key selectors that describe the
 	// beginning and end of a range.
@@ -182,6 +217,30 @@ type RangeOptions struct {
 	Reverse bool
 }
 
+// A ReadTransaction can asynchronously read from a FoundationDB
+// database. Transaction and Snapshot both satisfy the ReadTransaction
+// interface.
+type ReadTransaction interface {
+	Get(key KeyConvertible) FutureByteSlice
+	GetKey(sel Selectable) FutureKey
+	GetRange(r Range, options RangeOptions) RangeResult
+	GetReadVersion() FutureInt64
+	GetDatabase() Database
+	Snapshot() Snapshot
+
+	ReadTransactor
+}
+
+// ReadTransactor is satisfied by types that can perform a read-only
+// transactional function. Database, Transaction and Snapshot all
+// satisfy the ReadTransactor interface.
+type ReadTransactor interface {
+	// ReadTransact executes the caller-provided function, providing it with a
+	// ReadTransaction (itself a ReadTransactor, allowing composition of
+	// read-only transactional functions).
+	ReadTransact(func(ReadTransaction) (interface{}, error)) (interface{}, error)
+}
+
 type Selectable interface {
 	FDBKeySelector() KeySelector
 }
@@ -194,6 +253,35 @@ func (r SelectorRange) FDBRangeKeySelectors() (begin, end Selectable) {
 	return r.Begin, r.End
 }
 
+// Transactor is satisfied by types that can perform a transactional
+// function and commit if successful. Database and Transaction both
+// satisfy the Transactor interface.
+type Transactor interface {
+	// Transact executes the caller-provided function, providing it with a
+	// Transaction (itself a Transactor, allowing composition of transactional
+	// functions).
+	Transact(func(Transaction) (interface{}, error)) (interface{}, error)
+
+	// All Transactors are also ReadTransactors, allowing them to be used with
+	// read-only transactional functions.
+	ReadTransactor
+}
+
+// Strinc returns the first key that would sort outside the range prefixed by
+// prefix, or an error if prefix is empty or contains only 0xFF bytes.
+func Strinc(prefix []byte) ([]byte, error) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			ret := make([]byte, i+1)
+			copy(ret, prefix[:i+1])
+			ret[i]++
+			return ret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Key must contain at least one byte not equal to 0xFF")
+}
+
 type StreamingMode int
 
 const (
@@ -1,11 +1,59 @@
 package tinyfdb
 
+import "sync"
+
+// futureBase is ready once done is closed. A nil done channel means
+// it is always ready. Futures with a done channel are resolved later,
+// usually by a goroutine started with `transaction.goAsync`.
 type futureBase struct {
+	done      chan struct{}
+	once      sync.Once
+	cancelled bool
+
+	// run, if set, runs queued operations until done returns
+	// true. It is used for random completion order.
+	run func(done func() bool)
+}
+
+func (f *futureBase) BlockUntilReady() {
+	if f.run != nil {
+		f.run(f.IsReady)
+	}
+	if f.done != nil {
+		<-f.done
+	}
+}
+
+func (f *futureBase) IsReady() bool {
+	if f.done == nil {
+		return true
+	}
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel makes a future that isn't ready fail with an
+// operation_cancelled error. The operation itself may still complete,
+// but its result is discarded.
+func (f *futureBase) Cancel() {
+	f.resolve(func() { f.cancelled = true })
 }
 
-func (futureBase) BlockUntilReady() {}
-func (futureBase) IsReady() bool    { return true }
-func (futureBase) Cancel()          {}
+// resolve calls set and makes the future ready. Only the first call
+// has an effect.
+func (f *futureBase) resolve(set func()) {
+	if f.done == nil {
+		return
+	}
+	f.once.Do(func() {
+		set()
+		close(f.done)
+	})
+}
 
 type futureByteSlice struct {
 	futureBase
@@ -14,7 +62,15 @@ type futureByteSlice struct {
 	bs  []byte
 }
 
+func newFutureByteSlice() *futureByteSlice {
+	return &futureByteSlice{futureBase: futureBase{done: make(chan struct{})}}
+}
+
 func (f *futureByteSlice) Get() ([]byte, error) {
+	f.BlockUntilReady()
+	if f.cancelled {
+		return nil, errOperationCancelled
+	}
 	return f.bs, f.err
 }
 
@@ -26,13 +82,31 @@ func (f *futureByteSlice) MustGet() []byte {
 	return bs
 }
 
+// set makes the future ready. Only the first call has an effect.
+func (f *futureByteSlice) set(bs []byte, err error) {
+	f.resolve(func() {
+		f.bs = bs
+		f.err = err
+	})
+}
+
+// futureNil is a FutureNil. If created with newFutureNil, it can be
+// resolved later, using set.
 type futureNil struct {
 	futureBase
 
 	err error
 }
 
+func newFutureNil() *futureNil {
+	return &futureNil{futureBase: futureBase{done: make(chan struct{})}}
+}
+
 func (f *futureNil) Get() error {
+	f.BlockUntilReady()
+	if f.cancelled {
+		return errOperationCancelled
+	}
 	return f.err
 }
 
@@ -42,3 +116,121 @@ func (f *futureNil) MustGet() {
 		panic(err)
 	}
 }
+
+// set makes the future ready. Only the first call has an effect.
+func (f *futureNil) set(err error) {
+	f.resolve(func() { f.err = err })
+}
+
+type futureInt64 struct {
+	futureBase
+
+	err error
+	v   int64
+}
+
+func newFutureInt64() *futureInt64 {
+	return &futureInt64{futureBase: futureBase{done: make(chan struct{})}}
+}
+
+func (f *futureInt64) Get() (int64, error) {
+	f.BlockUntilReady()
+	if f.cancelled {
+		return 0, errOperationCancelled
+	}
+	return f.v, f.err
+}
+
+func (f *futureInt64) MustGet() int64 {
+	v, err := f.Get()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// set makes the future ready. Only the first call has an effect.
+func (f *futureInt64) set(v int64, err error) {
+	f.resolve(func() {
+		f.v = v
+		f.err = err
+	})
+}
+
+// futureKey is a FutureKey. If created with newFutureKey, it can be
+// resolved later, using set.
+type futureKey struct {
+	futureBase
+
+	k   Key
+	err error
+}
+
+func newFutureKey() *futureKey {
+	return &futureKey{futureBase: futureBase{done: make(chan struct{})}}
+}
+
+func (f *futureKey) Get() (Key, error) {
+	f.BlockUntilReady()
+	if f.cancelled {
+		return nil, errOperationCancelled
+	}
+	return f.k, f.err
+}
+
+func (f *futureKey) MustGet() Key {
+	k, err := f.Get()
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// set makes the future ready. Only the first call has an effect.
+func (f *futureKey) set(k Key, err error) {
+	f.resolve(func() {
+		f.k = k
+		f.err = err
+	})
+}
+
+// pendingOps counts the asynchronous operations of a transaction, so
+// they can be waited for. Unlike sync.WaitGroup, it can be reused
+// while operations are being added.
+type pendingOps struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // Closed when n drops to zero.
+}
+
+func (p *pendingOps) add() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.n == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.n++
+}
+
+func (p *pendingOps) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.n--
+	if p.n == 0 {
+		close(p.idle)
+	}
+}
+
+// wait blocks until there are no pending operations.
+func (p *pendingOps) wait() {
+	p.mu.Lock()
+	idle := p.idle
+	n := p.n
+	p.mu.Unlock()
+
+	if n > 0 {
+		<-idle
+	}
+}
@@ -0,0 +1,116 @@
+package tinyfdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFutures(t *testing.T) {
+	t.Run("fanOut", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		const n = 100
+		for i := 0; i < n; i++ {
+			commitValue(t, db, Key(fmt.Sprint(i)), []byte(fmt.Sprint(i)))
+		}
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			var fs []FutureByteSlice
+			for i := 0; i < n; i++ {
+				fs = append(fs, tx.Get(Key(fmt.Sprint(i))))
+			}
+			for i, f := range fs {
+				if got, want := string(f.MustGet()), fmt.Sprint(i); got != want {
+					t.Errorf("Get(%d): got %q, want %q", i, got, want)
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	})
+
+	t.Run("readYourWrites", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		f := tx.Get(Key("akey"))
+		k := tx.GetKey(FirstGreaterOrEqual(Key("a")))
+		tx.Set(Key("a"), []byte("anewvalue"))
+		tx.Set(Key("akey"), []byte("anewvalue"))
+
+		// Writes after a read was issued don't affect it.
+		if got, want := string(f.MustGet()), "avalue"; got != want {
+			t.Errorf("Get: got %q, want %q", got, want)
+		}
+		if got, want := string(k.MustGet()), "akey"; got != want {
+			t.Errorf("GetKey: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		f := newFutureByteSlice()
+		f.Cancel()
+
+		if !f.IsReady() {
+			t.Errorf("IsReady: got false, want true")
+		}
+		if _, err := f.Get(); !errors.Is(err, errOperationCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errOperationCancelled)
+		}
+
+		// Completing a cancelled operation has no effect.
+		f.set([]byte("avalue"), nil)
+		if _, err := f.Get(); !errors.Is(err, errOperationCancelled) {
+			t.Errorf("Get(set) err: got %v, want %v", err, errOperationCancelled)
+		}
+	})
+
+	t.Run("cancelReady", func(t *testing.T) {
+		f := newFutureNil()
+		f.set(nil)
+		f.Cancel()
+
+		if err := f.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("synchronous", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		db.Debug().SetSynchronousFutures(true)
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		fs := []Future{
+			tx.GetReadVersion(),
+			tx.Get(Key("akey")),
+			tx.GetKey(FirstGreaterOrEqual(Key("a"))),
+			tx.Commit(),
+		}
+		for i, f := range fs {
+			if !f.IsReady() {
+				t.Errorf("IsReady(%d): got false, want true", i)
+			}
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package tinyfdb
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A DebugOperation is a type of operation that DBDebug can inject
+// latency into.
+type DebugOperation int
+
+const (
+	DebugGet      DebugOperation = iota // Get, GetKey and GetReadVersion.
+	DebugGetRange                       // Each batch of a range read.
+	DebugCommit
+	DebugWatch // Delays a watch firing.
+)
+
+// A LatencyFunc returns the latency of one operation. It is given the
+// seeded random source of the database.
+type LatencyFunc func(rnd *rand.Rand) time.Duration
+
+// ConstantLatency returns a LatencyFunc that always returns d.
+func ConstantLatency(d time.Duration) LatencyFunc {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// UniformLatency returns a LatencyFunc that is uniformly distributed
+// in [min, max).
+func UniformLatency(min, max time.Duration) LatencyFunc {
+	return func(rnd *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(rnd.Int63n(int64(max-min)))
+	}
+}
+
+// SetLatency injects latency into operations of the given type. A nil
+// function removes it.
+func (d *DBDebug) SetLatency(op DebugOperation, f LatencyFunc) {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	if f == nil {
+		delete(dd.latencies, op)
+		return
+	}
+	dd.latencies[op] = f
+}
+
+// SetSeed seeds the random source used for latencies and completion
+// order. Given the same seed and the same sequence of calls, a
+// single-goroutine test runs the same way every time.
+func (d *DBDebug) SetSeed(seed int64) {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.rnd = rand.New(rand.NewSource(seed))
+}
+
+// SetRandomCompletionOrder makes asynchronous operations complete in a
+// random order, instead of running them on goroutines. Operations are
+// queued, and run one at a time, in random order, when a future is
+// waited for. A future is thus not ready until something waits for
+// it. This can e.g. make a read complete after a concurrent commit.
+func (d *DBDebug) SetRandomCompletionOrder(enabled bool) {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.randomOrder = enabled
+}
+
+// A queuedOp is an asynchronous operation waiting to be run in random
+// order.
+type queuedOp struct {
+	t *transaction
+	f func()
+}
+
+// latencyLocked returns an injected latency for an operation of the
+// given type.
+func (d *database) latencyLocked(op DebugOperation) time.Duration {
+	f := d.latencies[op]
+	if f == nil {
+		return 0
+	}
+	return f(d.rnd)
+}
+
+// runQueuedUntil runs queued operations in random order, until done
+// returns true or the queue is empty. Mutex: done is called with mu
+// held.
+func (d *database) runQueuedUntil(done func() bool) {
+	for {
+		d.mu.Lock()
+		if done() || len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		i := d.rnd.Intn(len(d.queue))
+		op := d.queue[i]
+		d.queue = append(d.queue[:i], d.queue[i+1:]...)
+		d.mu.Unlock()
+
+		op.f()
+	}
+}
+
+// hasQueuedLocked returns whether the transaction has operations in
+// the queue.
+func (d *database) hasQueuedLocked(t *transaction) bool {
+	for _, op := range d.queue {
+		if op.t == t {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepLatency sleeps for an injected latency of the operation type.
+func (t *transaction) sleepLatency(op DebugOperation) {
+	t.d.mu.Lock()
+	lat := t.d.latencyLocked(op)
+	t.d.mu.Unlock()
+
+	if lat > 0 {
+		time.Sleep(lat)
+	}
+}
+
+// goAsync runs f as a pending operation of the transaction, after any
+// injected latency. It normally runs in a new goroutine. If the
+// database uses synchronous futures, f runs before goAsync
+// returns. If it uses random completion order, f is queued, and run
+// when fb, or another future, is waited for.
+func (t *transaction) goAsync(op DebugOperation, fb *futureBase, f func()) {
+	t.d.mu.Lock()
+	synchronous := t.d.synchronousFutures
+	lat := t.d.latencyLocked(op)
+	run := func() {
+		if lat > 0 {
+			time.Sleep(lat)
+		}
+		f()
+	}
+
+	if synchronous {
+		t.d.mu.Unlock()
+		run()
+		return
+	}
+
+	// Commit waits for reads, so it isn't one.
+	isRead := op != DebugCommit
+	t.pending.add()
+	if isRead {
+		t.reads.add()
+	}
+	done := func() {
+		if isRead {
+			t.reads.done()
+		}
+		t.pending.done()
+	}
+
+	if t.d.randomOrder {
+		t.d.queue = append(t.d.queue, queuedOp{t: t, f: func() {
+			defer done()
+
+			run()
+		}})
+		fb.run = t.d.runQueuedUntil
+		t.d.mu.Unlock()
+		return
+	}
+	t.d.mu.Unlock()
+
+	go func() {
+		defer done()
+
+		run()
+	}()
+}
+
+// waitPending blocks until all asynchronous operations of the
+// transaction have completed. Queued operations are run, in random
+// order with those of other transactions.
+func (t *transaction) waitPending() {
+	t.d.runQueuedUntil(func() bool { return !t.d.hasQueuedLocked(t) })
+	t.pending.wait()
+}
+
+// waitReads blocks until all asynchronous reads of the transaction
+// have completed. Queued reads are run, like in waitPending.
+func (t *transaction) waitReads() {
+	t.d.runQueuedUntil(func() bool { return !t.d.hasQueuedLocked(t) })
+	t.reads.wait()
+}
@@ -0,0 +1,158 @@
+package tinyfdb
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDBDebugSetLatency(t *testing.T) {
+	const lat = 20 * time.Millisecond
+
+	tsts := []struct {
+		Name string
+		Op   DebugOperation
+		F    func(t *testing.T, db Database)
+	}{
+		{"get", DebugGet, func(t *testing.T, db Database) {
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			tx.Get(Key("akey")).MustGet()
+		}},
+		{"getRange", DebugGetRange, func(t *testing.T, db Database) {
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			it := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{}).Iterator()
+			for it.Advance() {
+				if _, err := it.Get(); err != nil {
+					t.Fatalf("Get failed: %v", err)
+				}
+			}
+		}},
+		{"commit", DebugCommit, func(t *testing.T, db Database) {
+			commitValue(t, db, Key("akey"), []byte("avalue"))
+		}},
+		{"watch", DebugWatch, func(t *testing.T, db Database) {
+			w, err := db.Transact(func(tx Transaction) (interface{}, error) {
+				return tx.Watch(Key("akey")), nil
+			})
+			if err != nil {
+				t.Fatalf("Transact failed: %v", err)
+			}
+			commitValue(t, db, Key("akey"), []byte("avalue"))
+			if w.(FutureNil).IsReady() {
+				t.Errorf("IsReady: got true, want false")
+			}
+			w.(FutureNil).MustGet()
+		}},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+			db.Debug().SetLatency(tst.Op, ConstantLatency(lat))
+
+			start := time.Now()
+			tst.F(t, db)
+			if got := time.Since(start); got < lat {
+				t.Errorf("elapsed: got %v, want at least %v", got, lat)
+			}
+		})
+	}
+}
+
+func TestWritesDontWaitForReads(t *testing.T) {
+	const lat = 300 * time.Millisecond
+
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+	commitValue(t, db, Key("akey"), []byte("avalue"))
+	db.Debug().SetLatency(DebugGet, ConstantLatency(lat))
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+	start := time.Now()
+	v := tx.Get(Key("akey"))
+	k := tx.GetKey(FirstGreaterOrEqual(Key("a")))
+	tx.Set(Key("a"), []byte("anewvalue"))
+	tx.Set(Key("akey"), []byte("anewvalue"))
+	c := tx.Commit()
+	if got := time.Since(start); got >= lat/2 {
+		t.Errorf("elapsed: got %v, want less than %v", got, lat/2)
+	}
+
+	// The reads don't see writes made after they were issued.
+	if got, want := string(v.MustGet()), "avalue"; got != want {
+		t.Errorf("Get: got %q, want %q", got, want)
+	}
+	if got, want := string(k.MustGet()), "akey"; got != want {
+		t.Errorf("GetKey: got %q, want %q", got, want)
+	}
+
+	// The commit waits for the reads.
+	if err := c.Get(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if got := time.Since(start); got < lat {
+		t.Errorf("Commit elapsed: got %v, want at least %v", got, lat)
+	}
+}
+
+func TestUniformLatency(t *testing.T) {
+	f := UniformLatency(10*time.Millisecond, 20*time.Millisecond)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		if got := f(rnd); got < 10*time.Millisecond || got >= 20*time.Millisecond {
+			t.Fatalf("UniformLatency: got %v, want in [10ms, 20ms)", got)
+		}
+	}
+}
+
+func TestDBDebugSetRandomCompletionOrder(t *testing.T) {
+	// readAfterCommit returns whether a read issued before a
+	// concurrent commit saw the committed value.
+	readAfterCommit := func(t *testing.T, seed int64) bool {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		db.Debug().SetSeed(seed)
+		db.Debug().SetRandomCompletionOrder(true)
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		f := tx.Get(Key("akey"))
+		if f.IsReady() {
+			t.Errorf("IsReady: got true, want false")
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+
+		return f.MustGet() != nil
+	}
+
+	seen := map[bool]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		got := readAfterCommit(t, seed)
+		seen[got] = true
+
+		if again := readAfterCommit(t, seed); again != got {
+			t.Errorf("readAfterCommit(%d): got %v, then %v", seed, got, again)
+		}
+	}
+	if !seen[false] || !seen[true] {
+		t.Errorf("readAfterCommit: got %v, want both orders", seen)
+	}
+}
@@ -0,0 +1,306 @@
+package tinyfdb
+
+import (
+	"math"
+	"time"
+)
+
+// transactionOptions are the options a transaction inherits from the
+// database. They are kept by OnError, but restored by Reset.
+type transactionOptions struct {
+	timeout       time.Duration // Zero means no timeout.
+	retryLimit    int           // Negative means no limit.
+	maxRetryDelay time.Duration
+	sizeLimit     int
+}
+
+const (
+	// defaultRetryLimit is the number of times OnError resets a
+	// transaction for retrying. FoundationDB has no limit by
+	// default, but this makes tests fail rather than hang.
+	defaultRetryLimit = 9
+
+	// defaultMaxRetryDelay caps the backoff delay in OnError.
+	// Conflicts in an in-memory database resolve quickly, so this
+	// is much lower than in FoundationDB.
+	defaultMaxRetryDelay = 50 * time.Millisecond
+
+	// defaultSizeLimit is the maximum size of a transaction, in
+	// bytes. It is also the largest allowed limit.
+	defaultSizeLimit = 10000000
+
+	// minSizeLimit is the smallest allowed transaction size limit.
+	minSizeLimit = 32
+)
+
+func defaultTransactionOptions() transactionOptions {
+	return transactionOptions{
+		retryLimit:    defaultRetryLimit,
+		maxRetryDelay: defaultMaxRetryDelay,
+		sizeLimit:     defaultSizeLimit,
+	}
+}
+
+// DatabaseOptions is a handle with which to set options that affect
+// a Database object. A DatabaseOptions instance should be obtained
+// with the (Database).Options method.
+type DatabaseOptions struct {
+	d *database
+}
+
+// Options returns a DatabaseOptions instance suitable for setting
+// options specific to this database.
+func (d Database) Options() DatabaseOptions {
+	return DatabaseOptions{d.database}
+}
+
+// SetTransactionTimeout sets the default timeout duration in
+// milliseconds for transactions created from this database. Valid
+// parameter values are [0, INT_MAX]. If set to 0, will disable all
+// timeouts. This only affects new transactions, and Reset.
+func (o DatabaseOptions) SetTransactionTimeout(param int64) error {
+	d, err := msDuration(param)
+	if err != nil {
+		return err
+	}
+	o.setTransactionOptions(func(opts *transactionOptions) { opts.timeout = d })
+	return nil
+}
+
+// SetTransactionRetryLimit sets the default maximum number of
+// retries for transactions created from this database. Valid
+// parameter values are [-1, INT_MAX]. If set to -1, will disable the
+// retry limit.
+func (o DatabaseOptions) SetTransactionRetryLimit(param int64) error {
+	if param < -1 {
+		return errInvalidOptionValue
+	}
+	o.setTransactionOptions(func(opts *transactionOptions) { opts.retryLimit = int(param) })
+	return nil
+}
+
+// SetTransactionMaxRetryDelay sets the default maximum backoff delay
+// in milliseconds for transactions created from this database. Valid
+// parameter values are [0, INT_MAX].
+func (o DatabaseOptions) SetTransactionMaxRetryDelay(param int64) error {
+	d, err := msDuration(param)
+	if err != nil {
+		return err
+	}
+	o.setTransactionOptions(func(opts *transactionOptions) { opts.maxRetryDelay = d })
+	return nil
+}
+
+// SetTransactionSizeLimit sets the default maximum transaction size
+// in bytes for transactions created from this database. Valid
+// parameter values are [32, 10,000,000].
+func (o DatabaseOptions) SetTransactionSizeLimit(param int64) error {
+	if param < minSizeLimit || param > defaultSizeLimit {
+		return errInvalidOptionValue
+	}
+	o.setTransactionOptions(func(opts *transactionOptions) { opts.sizeLimit = int(param) })
+	return nil
+}
+
+// SetMaxWatches sets the maximum number of watches allowed to be
+// outstanding on the database. Valid parameter values are
+// [0, 1,000,000]. The default is 10,000.
+func (o DatabaseOptions) SetMaxWatches(param int64) error {
+	if param < 0 || param > 1000000 {
+		return errInvalidOptionValue
+	}
+
+	o.d.mu.Lock()
+	defer o.d.mu.Unlock()
+
+	o.d.maxWatches = int(param)
+	return nil
+}
+
+func (o DatabaseOptions) setTransactionOptions(fun func(*transactionOptions)) {
+	o.d.mu.Lock()
+	defer o.d.mu.Unlock()
+
+	fun(&o.d.txOptions)
+}
+
+// The following options have no meaning in an in-memory database.
+// They are accepted for source compatibility.
+
+func (o DatabaseOptions) SetDatacenterId(param string) error                { return nil }
+func (o DatabaseOptions) SetLocationCacheSize(param int64) error            { return nil }
+func (o DatabaseOptions) SetMachineId(param string) error                   { return nil }
+func (o DatabaseOptions) SetSnapshotRywDisable() error                      { return nil }
+func (o DatabaseOptions) SetSnapshotRywEnable() error                       { return nil }
+func (o DatabaseOptions) SetTransactionBypassUnreadable() error             { return nil }
+func (o DatabaseOptions) SetTransactionCausalReadRisky() error              { return nil }
+func (o DatabaseOptions) SetTransactionIncludePortInAddress() error         { return nil }
+func (o DatabaseOptions) SetTransactionLoggingMaxFieldLength(p int64) error { return nil }
+func (o DatabaseOptions) SetTransactionReportConflictingKeys() error        { return nil }
+func (o DatabaseOptions) SetUseConfigDatabase() error                       { return nil }
+
+// TransactionOptions is a handle with which to set options that
+// affect a Transaction object. A TransactionOptions instance should
+// be obtained with the (Transaction).Options method.
+type TransactionOptions struct {
+	transaction *transaction
+}
+
+// Options returns a TransactionOptions instance suitable for setting
+// options specific to this transaction.
+func (t Transaction) Options() TransactionOptions {
+	return TransactionOptions{t.transaction}
+}
+
+// SetReadYourWritesDisable makes reads performed by the transaction
+// not see any prior mutations that occured in that transaction,
+// instead seeing the value which was in the database at the
+// transaction's read version. It is an error to set this option after
+// performing any reads or writes on the transaction.
+func (o TransactionOptions) SetReadYourWritesDisable() error {
+	t := o.transaction
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readSeq != 0 || t.writes.Len() > 0 {
+		return errClientInvalidOperation
+	}
+	t.readYourWrites = false
+	return nil
+}
+
+// SetTimeout sets a timeout in milliseconds which, when elapsed, will
+// cause the transaction to fail with a transaction_timed_out error.
+// The timeout is measured from when the transaction was created or
+// last reset, and is not affected by OnError. Valid parameter values
+// are [0, INT_MAX]. If set to 0, will disable all timeouts.
+func (o TransactionOptions) SetTimeout(param int64) error {
+	d, err := msDuration(param)
+	if err != nil {
+		return err
+	}
+	o.setOptions(func(opts *transactionOptions) { opts.timeout = d })
+	return nil
+}
+
+// SetRetryLimit sets a maximum number of retries after which
+// additional calls to OnError will return the most recently seen
+// error. Valid parameter values are [-1, INT_MAX]. If set to -1, will
+// disable the retry limit. The limit is kept by OnError.
+func (o TransactionOptions) SetRetryLimit(param int64) error {
+	if param < -1 {
+		return errInvalidOptionValue
+	}
+	o.setOptions(func(opts *transactionOptions) { opts.retryLimit = int(param) })
+	return nil
+}
+
+// SetMaxRetryDelay sets the maximum amount of backoff delay incurred
+// in the call to OnError, in milliseconds. Valid parameter values are
+// [0, INT_MAX].
+func (o TransactionOptions) SetMaxRetryDelay(param int64) error {
+	d, err := msDuration(param)
+	if err != nil {
+		return err
+	}
+	o.setOptions(func(opts *transactionOptions) { opts.maxRetryDelay = d })
+	return nil
+}
+
+// SetSizeLimit sets the transaction size limit in bytes. Commit fails
+// with a transaction_too_large error if the transaction is
+// larger. Valid parameter values are [32, 10,000,000].
+func (o TransactionOptions) SetSizeLimit(param int64) error {
+	if param < minSizeLimit || param > defaultSizeLimit {
+		return errInvalidOptionValue
+	}
+	o.setOptions(func(opts *transactionOptions) { opts.sizeLimit = int(param) })
+	return nil
+}
+
+// SetAccessSystemKeys allows this transaction to read and modify
+// system keys (those that start with the byte 0xFF).
+func (o TransactionOptions) SetAccessSystemKeys() error {
+	t := o.transaction
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.accessSystemKeys = true
+	t.readSystemKeys = true
+	return nil
+}
+
+// SetReadSystemKeys allows this transaction to read system keys
+// (those that start with the byte 0xFF).
+func (o TransactionOptions) SetReadSystemKeys() error {
+	t := o.transaction
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.readSystemKeys = true
+	return nil
+}
+
+// SetNextWriteNoWriteConflictRange makes the next write performed on
+// this transaction not generate a write conflict range. As a result,
+// other transactions which read the key(s) being modified by the next
+// write will not conflict with this transaction.
+func (o TransactionOptions) SetNextWriteNoWriteConflictRange() error {
+	t := o.transaction
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextWriteNoWriteConflictRange = true
+	return nil
+}
+
+func (o TransactionOptions) setOptions(fun func(*transactionOptions)) {
+	t := o.transaction
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fun(&t.opts)
+}
+
+// The following options have no meaning in an in-memory database.
+// They are accepted for source compatibility.
+
+func (o TransactionOptions) SetAutoThrottleTag(param string) error             { return nil }
+func (o TransactionOptions) SetBypassUnreadable() error                        { return nil }
+func (o TransactionOptions) SetCausalReadDisable() error                       { return nil }
+func (o TransactionOptions) SetCausalReadRisky() error                         { return nil }
+func (o TransactionOptions) SetCausalWriteRisky() error                        { return nil }
+func (o TransactionOptions) SetDebugTransactionIdentifier(param string) error  { return nil }
+func (o TransactionOptions) SetDurabilityDatacenter() error                    { return nil }
+func (o TransactionOptions) SetDurabilityRisky() error                         { return nil }
+func (o TransactionOptions) SetExpensiveClearCostEstimationEnable() error      { return nil }
+func (o TransactionOptions) SetIncludePortInAddress() error                    { return nil }
+func (o TransactionOptions) SetLockAware() error                               { return nil }
+func (o TransactionOptions) SetLogTransaction() error                          { return nil }
+func (o TransactionOptions) SetPriorityBatch() error                           { return nil }
+func (o TransactionOptions) SetPrioritySystemImmediate() error                 { return nil }
+func (o TransactionOptions) SetReadAheadDisable() error                        { return nil }
+func (o TransactionOptions) SetReadLockAware() error                           { return nil }
+func (o TransactionOptions) SetReportConflictingKeys() error                   { return nil }
+func (o TransactionOptions) SetServerRequestTracing() error                    { return nil }
+func (o TransactionOptions) SetSnapshotRywDisable() error                      { return nil }
+func (o TransactionOptions) SetSnapshotRywEnable() error                       { return nil }
+func (o TransactionOptions) SetSpanParent(param []byte) error                  { return nil }
+func (o TransactionOptions) SetTag(param string) error                         { return nil }
+func (o TransactionOptions) SetTransactionLoggingMaxFieldLength(p int64) error { return nil }
+func (o TransactionOptions) SetUsedDuringCommitProtectionDisable() error       { return nil }
+func (o TransactionOptions) SetUseGrvCache() error                             { return nil }
+func (o TransactionOptions) SetUseProvisionalProxies() error                   { return nil }
+
+// msDuration converts a millisecond option value to a duration.
+func msDuration(ms int64) (time.Duration, error) {
+	if ms < 0 || ms > math.MaxInt32 {
+		return 0, errInvalidOptionValue
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
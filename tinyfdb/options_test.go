@@ -0,0 +1,337 @@
+package tinyfdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransactionOptions(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		now := db.epoch
+		db.now = func() time.Time { return now }
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.Options().SetTimeout(100); err != nil {
+			t.Fatalf("SetTimeout failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+
+		now = now.Add(99 * time.Millisecond)
+		if _, err := tx.Get(Key("bkey")).Get(); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+
+		now = now.Add(1 * time.Millisecond)
+		if _, err := tx.Get(Key("bkey")).Get(); !errors.Is(err, errTransactionTimedOut) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionTimedOut)
+		}
+		if err := tx.OnError(errNotCommitted).Get(); !errors.Is(err, errTransactionTimedOut) {
+			t.Errorf("OnError err: got %v, want %v", err, errTransactionTimedOut)
+		}
+		if err := tx.Commit().Get(); !errors.Is(err, errTransactionTimedOut) {
+			t.Errorf("Commit err: got %v, want %v", err, errTransactionTimedOut)
+		}
+
+		// Reset restarts the timer, and clears the option.
+		tx.Reset()
+		now = now.Add(1 * time.Second)
+		tx.Set(Key("akey"), []byte("avalue"))
+		if err := tx.Commit().Get(); err != nil {
+			t.Errorf("Commit failed: %v", err)
+		}
+	})
+
+	t.Run("timeoutTransact", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		now := db.epoch
+		db.now = func() time.Time { return now }
+
+		var i int
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			tx.Options().SetTimeout(100)
+			now = now.Add(60 * time.Millisecond)
+			return nil, errNotCommitted
+		})
+		// The error from OnError is returned.
+		if !errors.Is(err, errTransactionTimedOut) {
+			t.Fatalf("Transact err: got %v, want %v", err, errTransactionTimedOut)
+		}
+
+		// OnError keeps the start time.
+		if want := 2; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+
+	t.Run("retryLimit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		var i int
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			if i == 1 {
+				// Kept by OnError.
+				tx.Options().SetRetryLimit(2)
+				tx.Options().SetMaxRetryDelay(0)
+			}
+			return nil, errNotCommitted
+		})
+		if !errors.Is(err, errNotCommitted) {
+			t.Fatalf("Transact err: got %v, want %v", err, errNotCommitted)
+		}
+
+		if want := 3; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+
+	t.Run("noRetryLimit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Options().SetRetryLimit(-1)
+		tx.Options().SetMaxRetryDelay(0)
+
+		for i := 0; i < 2*defaultRetryLimit; i++ {
+			if err := tx.OnError(errNotCommitted).Get(); err != nil {
+				t.Fatalf("OnError(%d) failed: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("sizeLimit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.Options().SetSizeLimit(32); err != nil {
+			t.Fatalf("SetSizeLimit failed: %v", err)
+		}
+		tx.Set(Key("akey"), make([]byte, 32))
+
+		if err := tx.Commit().Get(); !errors.Is(err, errTransactionTooLarge) {
+			t.Errorf("Commit err: got %v, want %v", err, errTransactionTooLarge)
+		}
+	})
+
+	t.Run("invalidValues", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		o := tx.Options()
+
+		for name, err := range map[string]error{
+			"SetTimeout":       o.SetTimeout(-1),
+			"SetRetryLimit":    o.SetRetryLimit(-2),
+			"SetMaxRetryDelay": o.SetMaxRetryDelay(-1),
+			"SetSizeLimit":     o.SetSizeLimit(31),
+			"SetSizeLimit2":    o.SetSizeLimit(defaultSizeLimit + 1),
+		} {
+			if !errors.Is(err, errInvalidOptionValue) {
+				t.Errorf("%s err: got %v, want %v", name, err, errInvalidOptionValue)
+			}
+		}
+	})
+
+	t.Run("systemKeys", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if _, err := tx.Get(Key("\xffakey")).Get(); !errors.Is(err, errKeyOutsideLegalRange) {
+			t.Errorf("Get err: got %v, want %v", err, errKeyOutsideLegalRange)
+		}
+		ri := tx.GetRange(KeyRange{Key("a"), Key("\xffa")}, RangeOptions{}).Iterator()
+		if !ri.Advance() {
+			t.Fatalf("Advance: got false, want true")
+		}
+		if _, err := ri.Get(); !errors.Is(err, errKeyOutsideLegalRange) {
+			t.Errorf("RangeIterator.Get err: got %v, want %v", err, errKeyOutsideLegalRange)
+		}
+		tx.Set(Key("\xffakey"), []byte("avalue"))
+		if err := tx.Commit().Get(); !errors.Is(err, errKeyOutsideLegalRange) {
+			t.Errorf("Commit err: got %v, want %v", err, errKeyOutsideLegalRange)
+		}
+
+		tx.Reset()
+		if err := tx.Options().SetReadSystemKeys(); err != nil {
+			t.Fatalf("SetReadSystemKeys failed: %v", err)
+		}
+		if _, err := tx.Get(Key("\xffakey")).Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+		tx.Set(Key("\xffakey"), []byte("avalue"))
+		if err := tx.Commit().Get(); !errors.Is(err, errKeyOutsideLegalRange) {
+			t.Errorf("Commit err: got %v, want %v", err, errKeyOutsideLegalRange)
+		}
+
+		tx.Reset()
+		if err := tx.Options().SetAccessSystemKeys(); err != nil {
+			t.Fatalf("SetAccessSystemKeys failed: %v", err)
+		}
+		tx.Set(Key("\xffakey"), []byte("avalue"))
+		if err := tx.Commit().Get(); err != nil {
+			t.Errorf("Commit failed: %v", err)
+		}
+	})
+
+	t.Run("nextWriteNoWriteConflictRange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.Options().SetNextWriteNoWriteConflictRange(); err != nil {
+			t.Fatalf("SetNextWriteNoWriteConflictRange failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+		tx.Set(Key("bkey"), []byte("bvalue"))
+
+		want := rangeSet{{Key("bkey"), keyAfter(Key("bkey"))}}
+		if got := tx.writeConflicts; !reflect.DeepEqual(got, want) {
+			t.Errorf("writeConflicts: got %v, want %v", got, want)
+		}
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if got, err := tx.GetCommittedVersion(); err != nil || got <= 0 {
+			t.Errorf("GetCommittedVersion: got %v, %v, want > 0", got, err)
+		}
+	})
+
+	t.Run("priorityBatch", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			if err := tx.Options().SetPriorityBatch(); err != nil {
+				return nil, err
+			}
+			tx.Set(Key("akey"), []byte("avalue"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	})
+}
+
+func TestDatabaseOptions(t *testing.T) {
+	t.Run("transactionDefaults", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		o := db.Options()
+		if err := o.SetTransactionTimeout(1000); err != nil {
+			t.Fatalf("SetTransactionTimeout failed: %v", err)
+		}
+		if err := o.SetTransactionRetryLimit(3); err != nil {
+			t.Fatalf("SetTransactionRetryLimit failed: %v", err)
+		}
+		if err := o.SetTransactionMaxRetryDelay(0); err != nil {
+			t.Fatalf("SetTransactionMaxRetryDelay failed: %v", err)
+		}
+		if err := o.SetTransactionSizeLimit(1000); err != nil {
+			t.Fatalf("SetTransactionSizeLimit failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		want := transactionOptions{timeout: time.Second, retryLimit: 3, sizeLimit: 1000}
+		if tx.opts != want {
+			t.Errorf("opts: got %+v, want %+v", tx.opts, want)
+		}
+
+		tx.Options().SetRetryLimit(5)
+		tx.Reset()
+		if tx.opts != want {
+			t.Errorf("opts(Reset): got %+v, want %+v", tx.opts, want)
+		}
+
+		var i int
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			return nil, errNotCommitted
+		})
+		if !errors.Is(err, errNotCommitted) {
+			t.Fatalf("Transact err: got %v, want %v", err, errNotCommitted)
+		}
+		if want := 4; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+
+	t.Run("maxWatches", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		if err := db.Options().SetMaxWatches(-1); !errors.Is(err, errInvalidOptionValue) {
+			t.Errorf("SetMaxWatches err: got %v, want %v", err, errInvalidOptionValue)
+		}
+		if err := db.Options().SetMaxWatches(0); err != nil {
+			t.Fatalf("SetMaxWatches failed: %v", err)
+		}
+
+		w, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			return tx.Watch(Key("akey")), nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+		if err := w.(FutureNil).Get(); !errors.Is(err, errTooManyWatches) {
+			t.Errorf("Get err: got %v, want %v", err, errTooManyWatches)
+		}
+	})
+}
@@ -1,10 +1,9 @@
 package tinyfdb
 
 import (
+	"bytes"
 	"fmt"
 	"math"
-
-	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
 )
 
 type RangeResult struct {
@@ -13,33 +12,28 @@ type RangeResult struct {
 	opts       RangeOptions
 
 	seq uint64
+	err error // Returned by the iterator, if set.
 }
 
 type rangeResultTx interface {
-	ascend(internal.Tuple, func(keyValue) bool)
-	descend(internal.Tuple, func(keyValue) bool)
-	setTaint([]byte, taintType)
+	getReadSeq() (uint64, error)
+	ascend(keyValue, func(keyValue) bool) error
+	descend(keyValue, func(keyValue) bool) error
+	addReadConflictRange(b, e Key)
+	sleepLatency(DebugOperation)
+	countRangeBatch(rows, bytes int)
 }
 
 func newRangeResult(t rangeResultTx, b, e KeySelector, opts RangeOptions) RangeResult {
-	begin, err := internal.UnpackTuple(b.Key.FDBKey())
-	if err != nil {
-		panic(fmt.Errorf("failed to unpack begin key: %w", err))
-	}
-	end, err := internal.UnpackTuple(e.Key.FDBKey())
-	if err != nil {
-		panic(fmt.Errorf("failed to unpack end key: %w", err))
-	}
-
 	return RangeResult{
 		t: t,
 		begin: keySelector{
-			Key:     begin,
+			Key:     b.Key.FDBKey(),
 			OrEqual: b.OrEqual,
 			Offset:  b.Offset,
 		},
 		end: keySelector{
-			Key:     end,
+			Key:     e.Key.FDBKey(),
 			OrEqual: e.OrEqual,
 			Offset:  e.Offset,
 		},
@@ -49,25 +43,80 @@ func newRangeResult(t rangeResultTx, b, e KeySelector, opts RangeOptions) RangeR
 
 func (rr RangeResult) Iterator() *RangeIterator {
 	it := &RangeIterator{
-		next:   keyMatcher{sel: rr.begin, inverse: rr.opts.Reverse},
-		end:    keyMatcher{sel: rr.end, inverse: rr.opts.Reverse},
-		scendf: rr.t.ascend,
-		rr:     rr,
+		next: keyMatcher{sel: rr.begin, inverse: rr.opts.Reverse},
+		end:  keyMatcher{sel: rr.end, inverse: rr.opts.Reverse},
+		rr:   rr,
+		mode: rr.opts.Mode,
+	}
+	if !rr.opts.Reverse {
+		it.conflict = rr.begin.conflictKey()
+	} else {
+		it.conflict = rr.end.conflictKey()
 	}
 	if rr.opts.Reverse {
+		// The end is exclusive, so in reverse we want the last key
+		// before it. The begin is inclusive, so we stop after it.
+		// This is exact for offset 1 (FirstGreater*).
 		it.next, it.end = it.end, it.next
-		it.scendf = rr.t.descend
+		it.next.sel.OrEqual = !it.next.sel.OrEqual
+		it.end.sel.OrEqual = !it.end.sel.OrEqual
 	}
 	return it
 }
 
+// GetSliceWithError reads the whole range. It returns the first
+// error encountered, e.g. if the transaction is cancelled or becomes
+// too old while reading. Like upstream, the streaming mode is
+// ignored: the range is read using StreamingModeExact if there is a
+// limit, and StreamingModeWantAll otherwise.
+func (rr RangeResult) GetSliceWithError() ([]KeyValue, error) {
+	var ret []KeyValue
+	ri := rr.Iterator()
+	if rr.opts.Limit > 0 {
+		ri.mode = StreamingModeExact
+	} else {
+		ri.mode = StreamingModeWantAll
+	}
+	for ri.Advance() {
+		kv, err := ri.Get()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, kv)
+	}
+	return ret, nil
+}
+
+// GetSliceOrPanic is like GetSliceWithError, but panics on error.
+func (rr RangeResult) GetSliceOrPanic() []KeyValue {
+	kvs, err := rr.GetSliceWithError()
+	if err != nil {
+		panic(err)
+	}
+	return kvs
+}
+
 type RangeIterator struct {
-	kv keyValue
+	kv  KeyValue
+	err error
+
+	next keyMatcher
+	end  keyMatcher
+	rr   RangeResult
+
+	// conflict is the boundary of the read conflict range added so
+	// far. It moves in iteration order.
+	conflict Key
 
-	next   keyMatcher
-	end    keyMatcher
-	scendf func(internal.Tuple, func(keyValue) bool)
-	rr     RangeResult
+	// cursor reads versions in iteration order. It is created on the
+	// first fetch.
+	cursor *rangeCursor
+
+	mode      StreamingMode
+	iteration int        // The number of batches fetched.
+	batch     []KeyValue // The rest of the current batch.
+	batchErr  error      // Returned after the batch, if set.
+	done      bool       // The range has been read to the end.
 
 	n int
 }
@@ -76,90 +125,314 @@ func (ri *RangeIterator) Advance() bool {
 	if n := ri.rr.opts.Limit; n > 0 && ri.n >= n {
 		return false
 	}
+	if ri.err != nil {
+		return false
+	}
+	if ri.rr.err != nil {
+		// Reported once by Get.
+		ri.err = ri.rr.err
+		return true
+	}
+
+	for len(ri.batch) == 0 {
+		if ri.batchErr != nil {
+			// Reported once by Get.
+			ri.err = ri.batchErr
+			return true
+		}
+		if ri.done {
+			return false
+		}
+		ri.fetch()
+	}
+
+	ri.kv = ri.batch[0]
+	ri.batch = ri.batch[1:]
+	ri.n++
+	return true
+}
+
+// fetch reads the next batch of key-value pairs, as limited by the
+// streaming mode. Like in FoundationDB, a batch is read as a whole,
+// so read conflict ranges cover the whole batch, and errors like
+// transaction_too_old happen at batch boundaries.
+func (ri *RangeIterator) fetch() {
+	ri.iteration++
+	rows, bytes, err := batchLimits(ri.mode, ri.iteration, ri.rr.opts.Limit)
+	if err != nil {
+		ri.batchErr = err
+		return
+	}
+	if rows > 0 {
+		rows -= ri.n
+	}
+
+	ri.rr.t.sleepLatency(DebugGetRange)
+
+	// The cursor may have versions buffered, so check that the read
+	// version is still readable.
+	if _, err := ri.rr.t.getReadSeq(); err != nil {
+		ri.batchErr = err
+		return
+	}
+
+	var batch []KeyValue
+	size := 0
+	for (rows <= 0 || len(batch) < rows) && (bytes <= 0 || size < bytes) {
+		kv, ok, err := ri.nextKey()
+		if err != nil {
+			// The whole batch fails.
+			ri.batchErr = err
+			return
+		}
+		if !ok {
+			ri.done = true
+			break
+		}
+		if kv.Ops != nil {
+			// An unresolved pending write.
+			ri.batchErr = errAccessedUnreadable
+			break
+		}
+
+		batch = append(batch, KeyValue{Key: kv.Key, Value: kv.Value})
+		size += len(kv.Key) + len(kv.Value)
+	}
+
+	ri.rr.t.countRangeBatch(len(batch), size)
+	ri.batch = batch
+}
 
+// nextKey returns the next key that isn't cleared, and extends the
+// read conflict range to include it. It returns false at the end of
+// the range.
+func (ri *RangeIterator) nextKey() (keyValue, bool, error) {
 	for {
-		var prev, found *keyValue
-		ri.scendf(ri.next.sel.Key, func(kv keyValue) bool {
-			if ri.end.Match(kv.Key[:len(kv.Key)-1]) != noMatch {
-				return false
+		// Keys are fed to the matcher once all versions of the key
+		// have been seen, since only the latest version is visible.
+		var prev, cur, found *keyValue
+		complete := func() bool {
+			switch ri.next.Match(cur.Key) {
+			case matchPrev:
+				found = prev
+			case matchCurrent:
+				found = cur
+			default:
+				prev = cur
+			}
+			return found != nil
+		}
+		if ri.cursor == nil {
+			ri.cursor = newRangeCursor(ri.rr.t, ri.next.sel.Key, ri.rr.opts.Reverse)
+		}
+		for {
+			kv, ok, err := ri.cursor.peek()
+			if err != nil {
+				return keyValue{}, false, err
+			}
+			if !ok {
+				break
 			}
 
-			if found != nil {
-				c, err := found.Key[:len(found.Key)-1].Cmp(kv.Key[:len(kv.Key)-1])
-				if err != nil {
-					panic(err)
+			if cur != nil {
+				if bytes.Equal(cur.Key, kv.Key) {
+					// Ascending order yields the latest version
+					// last, descending yields it first.
+					if !ri.rr.opts.Reverse {
+						cur = &kv
+					}
+					ri.cursor.skip()
+					continue
 				}
-				if c != 0 {
-					// The next item is a different key, so we've found
-					// the highest sequence number.
-					return false
+
+				// The first version of the next key is left in
+				// the cursor.
+				if complete() {
+					break
 				}
 			}
 
-			switch ri.next.Match(kv.Key[:len(kv.Key)-1]) {
-			case noMatch:
-				prev = &kv
-				return true
-
-			case matchPrev:
-				found = prev
-
-			case matchCurrent:
-				found = &kv
+			if ri.end.Match(kv.Key) != noMatch {
+				break
 			}
 
-			// We must find the last sequence number for this key, so
-			// carry on searching.
-			return true
-		})
+			cur = &kv
+			ri.cursor.skip()
+		}
 
+		if found == nil && cur != nil {
+			complete()
+		}
 		if found == nil && ri.next.End() == matchPrev {
 			found = prev
 		}
 
 		if found != nil {
-			if !ri.rr.opts.Reverse {
-				// Set the seq to max and add an empty field so we don't look
-				// at the same item again. This is like
-				// firstGreaterThan(found.Key[:-1]), but is a bit less verbose
-				// in tests.
-				k := make(internal.Tuple, len(found.Key)+1)
-				copy(k, found.Key)
-				k[len(k)-1] = uint64(math.MaxUint64)
-				ri.next = keyMatcher{sel: firstGreaterOrEqual(k)}
-			} else {
-				// For reverse iteration, we simply do
-				// firstGreaterThan, but cheap by setting the offset
-				// to skip the currently found key.
-				ri.next = keyMatcher{sel: keySelector{found.Key, true, 2}, inverse: true}
+			// Continue after the found key, in iteration order.
+			ri.next = keyMatcher{sel: firstGreaterThan(found.Key), inverse: ri.rr.opts.Reverse}
+			if found != cur {
+				// The cursor has passed keys after the found key.
+				ri.cursor.seek(found.Key)
 			}
 
-			if found.Value == nil {
+			ri.addConflict(found.Key)
+
+			if isTombstone(*found) {
 				// A tombstone.
 				continue
 			}
+			return *found, true, nil
+		}
+
+		// The rest of the range was read, and found empty.
+		if !ri.rr.opts.Reverse {
+			ri.rr.t.addReadConflictRange(ri.conflict, ri.rr.end.conflictKey())
+		} else {
+			ri.rr.t.addReadConflictRange(ri.rr.begin.conflictKey(), ri.conflict)
+		}
+		return keyValue{}, false, nil
+	}
+}
+
+// rangeBatchSize is the number of versions a rangeCursor reads from
+// the tree at a time. This is independent of the streaming mode.
+const rangeBatchSize = 256
+
+// A rangeCursor yields versions of keys in iteration order. It reads
+// them from the transaction in batches, and continues where the last
+// batch ended, so each version is only visited once.
+type rangeCursor struct {
+	t       rangeResultTx
+	reverse bool
+
+	pivot   keyValue // Where the next batch starts.
+	skipped bool     // The pivot was returned in the previous batch.
+	buf     []keyValue
+	eof     bool // There are no versions after buf.
+}
+
+func newRangeCursor(t rangeResultTx, k Key, reverse bool) *rangeCursor {
+	c := &rangeCursor{t: t, reverse: reverse}
+	c.seek(k)
+	return c
+}
 
-			ri.rr.t.setTaint(found.Key[:len(found.Key)-1].Pack(), readTaint)
-			ri.kv = *found
-			ri.n++
+// seek moves the cursor to the first version of k, or the first key
+// after it, in iteration order.
+func (c *rangeCursor) seek(k Key) {
+	c.pivot = keyValue{Key: k}
+	if c.reverse {
+		c.pivot.Seq = math.MaxUint64
+	}
+	c.skipped = false
+	c.buf = nil
+	c.eof = false
+}
+
+// peek returns the current version without consuming it. It returns
+// false if there are no more versions.
+func (c *rangeCursor) peek() (keyValue, bool, error) {
+	if len(c.buf) == 0 && !c.eof {
+		if err := c.fill(); err != nil {
+			return keyValue{}, false, err
+		}
+	}
+	if len(c.buf) == 0 {
+		return keyValue{}, false, nil
+	}
+	return c.buf[0], true, nil
+}
+
+// skip consumes the current version.
+func (c *rangeCursor) skip() {
+	c.buf = c.buf[1:]
+}
+
+// fill reads the next batch of versions.
+func (c *rangeCursor) fill() error {
+	var buf []keyValue
+	collect := func(kv keyValue) bool {
+		if c.skipped && len(buf) == 0 && !btreeBefore(c.pivot, kv) && !btreeBefore(kv, c.pivot) {
+			// Already returned in the previous batch.
 			return true
 		}
+		buf = append(buf, kv)
+		return len(buf) < rangeBatchSize
+	}
+	var err error
+	if !c.reverse {
+		err = c.t.ascend(c.pivot, collect)
+	} else {
+		err = c.t.descend(c.pivot, collect)
+	}
+	if err != nil {
+		return err
+	}
 
-		return false
+	c.buf = buf
+	if len(buf) < rangeBatchSize {
+		c.eof = true
+		return nil
+	}
+	c.pivot = buf[len(buf)-1]
+	c.skipped = true
+	return nil
+}
+
+// addConflict extends the read conflict range to include k.
+func (ri *RangeIterator) addConflict(k Key) {
+	next := keyAfter(k)
+	if !ri.rr.opts.Reverse {
+		b := ri.conflict
+		if bytes.Compare(k, b) < 0 {
+			b = k
+		}
+		ri.rr.t.addReadConflictRange(b, next)
+		ri.conflict = next
+	} else {
+		e := ri.conflict
+		if bytes.Compare(next, e) > 0 {
+			e = next
+		}
+		ri.rr.t.addReadConflictRange(k, e)
+		ri.conflict = k
 	}
 }
 
 func (ri *RangeIterator) Get() (KeyValue, error) {
-	return KeyValue{Key: ri.kv.Key[:len(ri.kv.Key)-1].Pack(), Value: ri.kv.Value}, nil
+	if ri.err != nil {
+		return KeyValue{}, ri.err
+	}
+	return ri.kv, nil
+}
+
+// MustGet is like Get, but panics on error.
+func (ri *RangeIterator) MustGet() KeyValue {
+	kv, err := ri.Get()
+	if err != nil {
+		panic(err)
+	}
+	return kv
 }
 
 type keySelector struct {
-	Key     internal.Tuple
+	Key     Key
 	OrEqual bool
 	Offset  int
 }
 
-func firstGreaterOrEqual(key internal.Tuple) keySelector { return keySelector{key, false, 1} }
+// conflictKey returns the key where a read conflict range bounded by
+// the selector begins or ends. This is exact for offset 1, and
+// otherwise only a starting point, extended by the keys read.
+func (s keySelector) conflictKey() Key {
+	if s.OrEqual {
+		return keyAfter(s.Key)
+	}
+	return s.Key
+}
+
+func firstGreaterOrEqual(key Key) keySelector { return keySelector{key, false, 1} }
+func firstGreaterThan(key Key) keySelector    { return keySelector{key, true, 1} }
 
 // A keyMatcher is a stateful matcher for a `keySelector`. For many
 // selectors (last-of), this needs a one item look-ahead, which means
@@ -177,15 +450,9 @@ type keyMatcher struct {
 // non-`noMatch`, no more calls to `Match` should be made. If `Match`
 // still hasn't returned a match at the end of the stream of keys,
 // `End` should be called.
-func (m *keyMatcher) Match(k internal.Tuple) matchResult {
-	var cmp int
-	if btreeBefore(k, m.sel.Key) {
-		// Key is earlier than selector.
-		cmp = -1
-	} else if btreeBefore(m.sel.Key, k) {
-		// Key is later than selector.
-		cmp = 1
-	}
+func (m *keyMatcher) Match(k Key) matchResult {
+	// Negative if the key is earlier than the selector.
+	cmp := bytes.Compare(k, m.sel.Key)
 	if m.inverse {
 		cmp = -cmp
 	}
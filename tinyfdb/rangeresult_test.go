@@ -1,96 +1,149 @@
 package tinyfdb
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/tidwall/btree"
-	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
 )
 
 func TestRangeResult(t *testing.T) {
-	makeKey := func(k byte, seq uint64) internal.Tuple {
-		return internal.Tuple{[]byte{k}, seq}
-	}
-	makeKey2 := func(k byte, seq uint64) []byte {
-		return makeKey(k, seq)[:1].Pack()
-	}
-
 	tx := fakeRangeResultTransaction{
-		Keys: []internal.Tuple{
-			makeKey(10, 1),
-			makeKey(11, 1),
-			makeKey(12, 1),
+		Keys: []keyValue{
+			{Key: Key{10}, Seq: 1},
+			{Key: Key{11}, Seq: 1},
+			{Key: Key{12}, Seq: 1},
 		},
 	}
-	rr := newRangeResult(&tx, FirstGreaterOrEqual(Key(nil)), FirstGreaterThan(Key((internal.Tuple{[]byte{0xFF}}).Pack())), RangeOptions{})
+	rr := newRangeResult(&tx, FirstGreaterOrEqual(Key(nil)), FirstGreaterThan(Key{0xFF}), RangeOptions{})
 	ri := rr.Iterator()
 
-	var got [][]byte
+	var got []Key
 	for ri.Advance() {
 		kv, _ := ri.Get()
 		got = append(got, kv.Key)
 	}
 
-	want := [][]byte{
-		makeKey2(10, 1),
-		makeKey2(11, 1),
-		makeKey2(12, 1),
-	}
+	want := []Key{{10}, {11}, {12}}
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("Advance: got %+v, want %+v", got, want)
 	}
 }
 
+func TestRangeResultGetSlice(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tx := fakeRangeResultTransaction{
+			Keys: []keyValue{
+				{Key: Key{10}, Seq: 1},
+				{Key: Key{11}, Seq: 1},
+			},
+		}
+		rr := newRangeResult(&tx, FirstGreaterOrEqual(Key(nil)), FirstGreaterThan(Key{0xFF}), RangeOptions{})
+
+		got, err := rr.GetSliceWithError()
+		if err != nil {
+			t.Fatalf("GetSliceWithError failed: %v", err)
+		}
+		want := []KeyValue{
+			{Key: Key{10}, Value: []byte("[10] 1")},
+			{Key: Key{11}, Value: []byte("[11] 1")},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetSliceWithError: got %+v, want %+v", got, want)
+		}
+		if got := rr.GetSliceOrPanic(); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetSliceOrPanic: got %+v, want %+v", got, want)
+		}
+
+		ri := rr.Iterator()
+		ri.Advance()
+		if got := ri.MustGet(); !reflect.DeepEqual(got, want[0]) {
+			t.Errorf("MustGet: got %+v, want %+v", got, want[0])
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tx := fakeRangeResultTransaction{
+			Keys: []keyValue{{Key: Key{10}, Seq: 1}},
+			Err:  errTransactionTooOld,
+		}
+		rr := newRangeResult(&tx, FirstGreaterOrEqual(Key(nil)), FirstGreaterThan(Key{0xFF}), RangeOptions{})
+
+		if _, err := rr.GetSliceWithError(); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("GetSliceWithError err: got %v, want %v", err, errTransactionTooOld)
+		}
+
+		if err := recoverError(func() { rr.GetSliceOrPanic() }); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("GetSliceOrPanic panic: got %v, want %v", err, errTransactionTooOld)
+		}
+
+		ri := rr.Iterator()
+		if !ri.Advance() {
+			t.Fatalf("Advance: got false, want true")
+		}
+		if err := recoverError(func() { ri.MustGet() }); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("MustGet panic: got %v, want %v", err, errTransactionTooOld)
+		}
+		if ri.Advance() {
+			t.Errorf("Advance after error: got true, want false")
+		}
+	})
+}
+
+// recoverError calls f and returns the error it panics with, if any.
+func recoverError(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	f()
+	return nil
+}
+
 func TestRangeIterator(t *testing.T) {
-	makeKey := func(k byte, seq uint64) internal.Tuple {
-		return internal.Tuple{[]byte{k}, seq}
-	}
-	makeKey2 := func(k byte, seq uint64) internal.Tuple {
-		return makeKey(k, seq)[:1]
+	makeKey := func(k byte, seq uint64) keyValue {
+		return keyValue{Key: Key{k}, Seq: seq}
 	}
 
 	tsts := []struct {
 		Name  string
-		Begin internal.Tuple
-		End   internal.Tuple
-		Keys  []internal.Tuple
+		Begin Key
+		End   Key
+		Keys  []keyValue
 		Opts  RangeOptions
 
-		WantKeys []internal.Tuple
+		WantKeys []keyValue
 	}{
 		{"empty", nil, nil, nil, RangeOptions{}, nil},
-		{"all", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}},
+		{"all", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}},
+
+		{"skipBegin", Key{11}, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []keyValue{makeKey(11, 1), makeKey(12, 1)}},
+		{"skipEnd", nil, Key{11}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []keyValue{makeKey(10, 1)}},
 
-		{"skipBegin", makeKey2(11, 1), makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []internal.Tuple{makeKey(11, 1), makeKey(12, 1)}},
-		{"skipEnd", nil, makeKey2(11, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{}, []internal.Tuple{makeKey(10, 1)}},
+		{"lastSeq", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, RangeOptions{}, []keyValue{makeKey(10, 2), makeKey(11, 1)}},
+		{"lastSeqEnd", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(10, 2)}, RangeOptions{}, []keyValue{makeKey(10, 2)}},
 
-		{"lastSeq", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, RangeOptions{}, []internal.Tuple{makeKey(10, 2), makeKey(11, 1)}},
-		{"lastSeqEnd", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(10, 2)}, RangeOptions{}, []internal.Tuple{makeKey(10, 2)}},
+		{"reverse", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{Reverse: true}, []keyValue{makeKey(12, 1), makeKey(11, 1), makeKey(10, 1)}},
+		{"reverseBounds", Key{11}, Key{12}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{Reverse: true}, []keyValue{makeKey(11, 1)}},
+		{"reverseLastSeq", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(11, 1), makeKey(11, 2), makeKey(11, 3)}, RangeOptions{Reverse: true}, []keyValue{makeKey(11, 3), makeKey(10, 1)}},
 
-		{"reverse", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{Reverse: true}, []internal.Tuple{makeKey(12, 1), makeKey(11, 1), makeKey(10, 1)}},
-		{"limit", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(11, 1), makeKey(12, 1)}, RangeOptions{Limit: 1}, []internal.Tuple{makeKey(10, 1)}},
+		{"prefixes", Key("a"), Key("b"), []keyValue{{Key: Key("a"), Seq: 1}, {Key: Key("a\x00"), Seq: 1}, {Key: Key("ab"), Seq: 1}, {Key: Key("b"), Seq: 1}}, RangeOptions{}, []keyValue{{Key: Key("a"), Seq: 1}, {Key: Key("a\x00"), Seq: 1}, {Key: Key("ab"), Seq: 1}}},
 	}
 	for _, tst := range tsts {
 		t.Run(tst.Name, func(t *testing.T) {
 			tx := fakeRangeResultTransaction{
 				Keys: tst.Keys,
 			}
-			ri := RangeIterator{
-				rr: RangeResult{
-					t:    &tx,
-					opts: tst.Opts,
-					seq:  5,
-				},
-				next:   keyMatcher{sel: firstGreaterOrEqual(tst.Begin), inverse: tst.Opts.Reverse},
-				end:    keyMatcher{sel: firstGreaterOrEqual(tst.End), inverse: tst.Opts.Reverse},
-				scendf: tx.ascend,
-			}
-			if tst.Opts.Reverse {
-				ri.next, ri.end = ri.end, ri.next
-				ri.scendf = tx.descend
-			}
+			ri := RangeResult{
+				t:     &tx,
+				begin: firstGreaterOrEqual(tst.Begin),
+				end:   firstGreaterOrEqual(tst.End),
+				opts:  tst.Opts,
+				seq:   5,
+			}.Iterator()
 
 			var gotValues []string
 			for ri.Advance() {
@@ -99,32 +152,30 @@ func TestRangeIterator(t *testing.T) {
 			}
 
 			var wantValues []string
-			var wantTaints []internal.Tuple
 			for _, k := range tst.WantKeys {
-				wantValues = append(wantValues, fmt.Sprint(k))
-				wantTaints = append(wantTaints, k[:len(k)-1])
+				wantValues = append(wantValues, fmt.Sprint(k.Key, k.Seq))
 			}
 			if !reflect.DeepEqual(gotValues, wantValues) {
 				t.Errorf("Advance: got %+v, want %+v", gotValues, wantValues)
 			}
 
-			if !reflect.DeepEqual(tx.GotTaint, wantTaints) {
-				t.Errorf("Advance GotTaint: got %+v, want %+v", tx.GotTaint, wantTaints)
+			if want := (rangeSet{{tst.Begin, tst.End}}); tst.End != nil && !reflect.DeepEqual(tx.GotConflicts, want) {
+				t.Errorf("Advance GotConflicts: got %+v, want %+v", tx.GotConflicts, want)
 			}
 		})
 	}
 
 	tsts2 := []struct {
 		Name   string
-		Begin  internal.Tuple
-		End    internal.Tuple
-		Keys   []internal.Tuple
+		Begin  Key
+		End    Key
+		Keys   []keyValue
 		Values [][]byte
 
-		WantKeys []internal.Tuple
+		WantKeys []keyValue
 	}{
-		{"earlierTombstone", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(10, 2)}, [][]byte{nil, []byte(fmt.Sprint(makeKey(10, 2)))}, []internal.Tuple{makeKey(10, 2)}},
-		{"latestTombstone", nil, makeKey2(0xFF, 0xFF), []internal.Tuple{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, [][]byte{{42}, nil, []byte(fmt.Sprint(makeKey(11, 1)))}, []internal.Tuple{makeKey(11, 1)}},
+		{"earlierTombstone", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(10, 2)}, [][]byte{nil, []byte(fmt.Sprint(Key{10}, 2))}, []keyValue{makeKey(10, 2)}},
+		{"latestTombstone", nil, Key{0xFF}, []keyValue{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, [][]byte{{42}, nil, []byte(fmt.Sprint(Key{11}, 1))}, []keyValue{makeKey(11, 1)}},
 	}
 	for _, tst := range tsts2 {
 		t.Run(tst.Name, func(t *testing.T) {
@@ -132,15 +183,12 @@ func TestRangeIterator(t *testing.T) {
 				Keys:  tst.Keys,
 				Value: func(i int) []byte { return tst.Values[i] },
 			}
-			ri := RangeIterator{
-				rr: RangeResult{
-					t:   &tx,
-					seq: 5,
-				},
-				next:   keyMatcher{sel: firstGreaterOrEqual(tst.Begin)},
-				end:    keyMatcher{sel: firstGreaterOrEqual(tst.End)},
-				scendf: tx.ascend,
-			}
+			ri := RangeResult{
+				t:     &tx,
+				begin: firstGreaterOrEqual(tst.Begin),
+				end:   firstGreaterOrEqual(tst.End),
+				seq:   5,
+			}.Iterator()
 
 			var gotValues []string
 			for ri.Advance() {
@@ -149,107 +197,205 @@ func TestRangeIterator(t *testing.T) {
 			}
 
 			var wantValues []string
-			var wantTaints []internal.Tuple
 			for _, k := range tst.WantKeys {
-				wantValues = append(wantValues, fmt.Sprint(k))
-				wantTaints = append(wantTaints, k[:len(k)-1])
+				wantValues = append(wantValues, fmt.Sprint(k.Key, k.Seq))
 			}
 			if !reflect.DeepEqual(gotValues, wantValues) {
 				t.Errorf("Advance: got %+v, want %+v", gotValues, wantValues)
 			}
 
-			if !reflect.DeepEqual(tx.GotTaint, wantTaints) {
-				t.Errorf("Advance GotTaint: got %+v, want %+v", tx.GotTaint, wantTaints)
+			if want := (rangeSet{{tst.Begin, tst.End}}); tst.End != nil && !reflect.DeepEqual(tx.GotConflicts, want) {
+				t.Errorf("Advance GotConflicts: got %+v, want %+v", tx.GotConflicts, want)
+			}
+		})
+	}
+}
+
+func TestRangeIteratorConflicts(t *testing.T) {
+	keys := []keyValue{{Key: Key{10}, Seq: 1}, {Key: Key{11}, Seq: 1}, {Key: Key{12}, Seq: 1}}
+
+	tsts := []struct {
+		Name  string
+		Begin keySelector
+		End   keySelector
+		Opts  RangeOptions
+
+		WantKeys      int
+		WantConflicts rangeSet
+	}{
+		{"all", firstGreaterOrEqual(Key{1}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{}, 3, rangeSet{{Key{1}, Key{0xFF}}}},
+		{"empty", firstGreaterOrEqual(Key{20}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{}, 0, rangeSet{{Key{20}, Key{0xFF}}}},
+		{"afterBegin", firstGreaterThan(Key{10}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{}, 2, rangeSet{{Key{10, 0}, Key{0xFF}}}},
+		{"limit", firstGreaterOrEqual(Key{1}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{Limit: 1}, 1, rangeSet{{Key{1}, Key{10, 0}}}},
+		{"reverse", firstGreaterOrEqual(Key{1}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{Reverse: true}, 3, rangeSet{{Key{1}, Key{0xFF}}}},
+		{"reverseLimit", firstGreaterOrEqual(Key{1}), firstGreaterOrEqual(Key{0xFF}), RangeOptions{Limit: 2, Reverse: true}, 2, rangeSet{{Key{11}, Key{0xFF}}}},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			tx := fakeRangeResultTransaction{Keys: keys}
+			ri := RangeResult{
+				t:     &tx,
+				begin: tst.Begin,
+				end:   tst.End,
+				opts:  tst.Opts,
+				seq:   5,
+			}.Iterator()
+
+			var n int
+			for ri.Advance() {
+				n++
+			}
+
+			if n != tst.WantKeys {
+				t.Errorf("Advance: got %d keys, want %d", n, tst.WantKeys)
+			}
+			if !reflect.DeepEqual(tx.GotConflicts, tst.WantConflicts) {
+				t.Errorf("Advance GotConflicts: got %+v, want %+v", tx.GotConflicts, tst.WantConflicts)
+			}
+		})
+	}
+}
+
+func TestRangeCursor(t *testing.T) {
+	// Enough versions for several batches, with two versions of
+	// each key.
+	var keys []keyValue
+	for i := 0; i < 3*rangeBatchSize/2; i++ {
+		k := Key(fmt.Sprintf("%04d", i))
+		keys = append(keys, keyValue{Key: k, Seq: 1}, keyValue{Key: k, Seq: 2})
+	}
+	reversed := make([]keyValue, len(keys))
+	for i, kv := range keys {
+		reversed[len(keys)-1-i] = kv
+	}
+
+	tsts := []struct {
+		Name    string
+		Key     Key
+		Reverse bool
+		Want    []keyValue
+	}{
+		{"forward", nil, false, keys},
+		{"reverse", Key{0xFF}, true, reversed},
+		{"seek", keys[10].Key, false, keys[10:]},
+		{"reverseSeek", keys[10].Key, true, reversed[len(keys)-12:]},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			tx := fakeRangeResultTransaction{Keys: keys, Value: func(int) []byte { return nil }}
+			c := newRangeCursor(&tx, tst.Key, tst.Reverse)
+
+			var got []keyValue
+			for {
+				kv, ok, err := c.peek()
+				if err != nil {
+					t.Fatalf("peek failed: %v", err)
+				}
+				if !ok {
+					break
+				}
+				got = append(got, kv)
+				c.skip()
+			}
+
+			if !reflect.DeepEqual(got, tst.Want) {
+				t.Errorf("peek: got %d versions, want %d", len(got), len(tst.Want))
 			}
 		})
 	}
 }
 
 type fakeRangeResultTransaction struct {
-	Keys     []internal.Tuple
-	Value    func(int) []byte
-	GotTaint []internal.Tuple
+	Keys         []keyValue
+	Value        func(int) []byte
+	GotConflicts rangeSet
+	Err          error // Returned by ascend and descend, if set.
 
 	bt *btree.BTree
 }
 
-func (t *fakeRangeResultTransaction) ascend(pivot internal.Tuple, fun func(keyValue) bool) {
-	if t.bt == nil {
-		t.bt = btree.NewNonConcurrent(btreeBefore)
-		for i, key := range t.Keys {
-			v := []byte(fmt.Sprint(key))
-			if t.Value != nil {
-				v = t.Value(i)
-			}
-			t.bt.Set(keyValue{key, v})
+func (t *fakeRangeResultTransaction) init() {
+	if t.bt != nil {
+		return
+	}
+
+	t.bt = btree.NewNonConcurrent(btreeBefore)
+	for i, kv := range t.Keys {
+		kv.Value = []byte(fmt.Sprint(kv.Key, kv.Seq))
+		if t.Value != nil {
+			kv.Value = t.Value(i)
 		}
+		t.bt.Set(kv)
 	}
+}
 
+func (t *fakeRangeResultTransaction) ascend(pivot keyValue, fun func(keyValue) bool) error {
+	t.init()
+	if t.Err != nil {
+		return t.Err
+	}
 	t.bt.Ascend(pivot, func(item interface{}) bool {
 		return fun(item.(keyValue))
 	})
+	return nil
 }
 
-func (t *fakeRangeResultTransaction) descend(pivot internal.Tuple, fun func(keyValue) bool) {
-	if t.bt == nil {
-		t.bt = btree.NewNonConcurrent(btreeBefore)
-		for i, key := range t.Keys {
-			v := []byte(fmt.Sprint(key))
-			if t.Value != nil {
-				v = t.Value(i)
-			}
-			t.bt.Set(keyValue{key, v})
-		}
+func (t *fakeRangeResultTransaction) descend(pivot keyValue, fun func(keyValue) bool) error {
+	t.init()
+	if t.Err != nil {
+		return t.Err
 	}
-
 	t.bt.Descend(pivot, func(item interface{}) bool {
 		return fun(item.(keyValue))
 	})
+	return nil
 }
 
-func (t *fakeRangeResultTransaction) setTaint(key []byte, typ taintType) {
-	kt, err := internal.UnpackTuple(key)
-	if err != nil {
-		panic(err)
-	}
-	t.GotTaint = append(t.GotTaint, kt)
+func (t *fakeRangeResultTransaction) addReadConflictRange(b, e Key) {
+	t.GotConflicts.Add(b, e)
 }
 
+func (t *fakeRangeResultTransaction) getReadSeq() (uint64, error) { return 1, t.Err }
+
+func (t *fakeRangeResultTransaction) sleepLatency(DebugOperation) {}
+
+func (t *fakeRangeResultTransaction) countRangeBatch(rows, bytes int) {}
+
 func TestKeyMatcher(t *testing.T) {
 	var (
-		emptyKey internal.Tuple = nil
-		aKey                    = internal.Tuple{[]byte{0}}
+		emptyKey Key = nil
+		aKey         = Key{0}
 	)
 
 	tsts := []struct {
 		Name   string
 		Sel    keySelector
-		KeySeq []internal.Tuple
+		KeySeq []Key
 		Want   int
 	}{
 		{"lastLessThanEmpty", lastLessThan(emptyKey), nil, -1},
-		{"lastLessThanNoMatch", lastLessThan(emptyKey), []internal.Tuple{emptyKey}, -1},
-		{"lastLessThanMatchLast", lastLessThan(aKey), []internal.Tuple{emptyKey}, 0},
-		{"lastLessThanMatch", lastLessThan(aKey), []internal.Tuple{emptyKey, aKey}, 0},
-		{"lastLessThanMatchEqual", lastLessThan(aKey), []internal.Tuple{emptyKey, emptyKey, aKey}, 1},
+		{"lastLessThanNoMatch", lastLessThan(emptyKey), []Key{emptyKey}, -1},
+		{"lastLessThanMatchLast", lastLessThan(aKey), []Key{emptyKey}, 0},
+		{"lastLessThanMatch", lastLessThan(aKey), []Key{emptyKey, aKey}, 0},
+		{"lastLessThanMatchEqual", lastLessThan(aKey), []Key{emptyKey, emptyKey, aKey}, 1},
 
 		{"lastLessOrEqualEmpty", lastLessOrEqual(emptyKey), nil, -1},
-		{"lastLessOrEqualNoMatch", lastLessOrEqual(emptyKey), []internal.Tuple{aKey}, -1},
-		{"lastLessOrEqualMatchLast", lastLessOrEqual(aKey), []internal.Tuple{aKey}, 0},
-		{"lastLessOrEqualMatch", lastLessOrEqual(emptyKey), []internal.Tuple{emptyKey, aKey}, 0},
-		{"lastLessOrEqualMatchEqual", lastLessOrEqual(emptyKey), []internal.Tuple{emptyKey, emptyKey, aKey}, 1},
+		{"lastLessOrEqualNoMatch", lastLessOrEqual(emptyKey), []Key{aKey}, -1},
+		{"lastLessOrEqualMatchLast", lastLessOrEqual(aKey), []Key{aKey}, 0},
+		{"lastLessOrEqualMatch", lastLessOrEqual(emptyKey), []Key{emptyKey, aKey}, 0},
+		{"lastLessOrEqualMatchEqual", lastLessOrEqual(emptyKey), []Key{emptyKey, emptyKey, aKey}, 1},
 
 		{"firstGreaterThanEmpty", firstGreaterThan(emptyKey), nil, -1},
-		{"firstGreaterThanNoMatch", firstGreaterThan(emptyKey), []internal.Tuple{emptyKey}, -1},
-		{"firstGreaterThanMatchLast", firstGreaterThan(emptyKey), []internal.Tuple{aKey}, 0},
-		{"firstGreaterThanMatch", firstGreaterThan(emptyKey), []internal.Tuple{emptyKey, aKey}, 1},
-		{"firstGreaterThanMatchEqual", firstGreaterThan(emptyKey), []internal.Tuple{emptyKey, emptyKey, aKey}, 2},
+		{"firstGreaterThanNoMatch", firstGreaterThan(emptyKey), []Key{emptyKey}, -1},
+		{"firstGreaterThanMatchLast", firstGreaterThan(emptyKey), []Key{aKey}, 0},
+		{"firstGreaterThanMatch", firstGreaterThan(emptyKey), []Key{emptyKey, aKey}, 1},
+		{"firstGreaterThanMatchEqual", firstGreaterThan(emptyKey), []Key{emptyKey, emptyKey, aKey}, 2},
 
 		{"firstGreaterOrEqualEmpty", firstGreaterOrEqual(emptyKey), nil, -1},
-		{"firstGreaterOrEqualNoMatch", firstGreaterOrEqual(aKey), []internal.Tuple{emptyKey}, -1},
-		{"firstGreaterOrEqualMatchLast", firstGreaterOrEqual(emptyKey), []internal.Tuple{emptyKey}, 0},
-		{"firstGreaterOrEqualMatch", firstGreaterOrEqual(aKey), []internal.Tuple{emptyKey, aKey}, 1},
-		{"firstGreaterOrEqualMatchEqual", firstGreaterOrEqual(aKey), []internal.Tuple{emptyKey, aKey, aKey}, 1},
+		{"firstGreaterOrEqualNoMatch", firstGreaterOrEqual(aKey), []Key{emptyKey}, -1},
+		{"firstGreaterOrEqualMatchLast", firstGreaterOrEqual(emptyKey), []Key{emptyKey}, 0},
+		{"firstGreaterOrEqualMatch", firstGreaterOrEqual(aKey), []Key{emptyKey, aKey}, 1},
+		{"firstGreaterOrEqualMatchEqual", firstGreaterOrEqual(aKey), []Key{emptyKey, aKey, aKey}, 1},
 	}
 	for _, tst := range tsts {
 		t.Run(tst.Name, func(t *testing.T) {
@@ -287,6 +433,5 @@ func TestKeyMatcher(t *testing.T) {
 	}
 }
 
-func lastLessThan(key internal.Tuple) keySelector     { return keySelector{key, false, 0} }
-func lastLessOrEqual(key internal.Tuple) keySelector  { return keySelector{key, true, 0} }
-func firstGreaterThan(key internal.Tuple) keySelector { return keySelector{key, true, 1} }
+func lastLessThan(key Key) keySelector    { return keySelector{key, false, 0} }
+func lastLessOrEqual(key Key) keySelector { return keySelector{key, true, 0} }
@@ -0,0 +1,77 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"sort"
+)
+
+// A keyRange is the half-open range of keys [Begin, End).
+type keyRange struct {
+	Begin, End Key
+}
+
+// A rangeSet is a set of keys, stored as sorted, disjoint and
+// non-adjacent key ranges.
+//
+// This is goroutine-compatible.
+type rangeSet []keyRange
+
+// Add adds the range [b, e) to the set, merging it with any
+// overlapping or adjacent ranges.
+func (s *rangeSet) Add(b, e Key) {
+	if bytes.Compare(b, e) >= 0 {
+		return
+	}
+
+	rs := *s
+	// The first range that ends at or after b.
+	i := sort.Search(len(rs), func(i int) bool { return bytes.Compare(rs[i].End, b) >= 0 })
+	// The first range that begins after e.
+	j := sort.Search(len(rs), func(i int) bool { return bytes.Compare(rs[i].Begin, e) > 0 })
+	if i < j {
+		if bytes.Compare(rs[i].Begin, b) < 0 {
+			b = rs[i].Begin
+		}
+		if bytes.Compare(rs[j-1].End, e) > 0 {
+			e = rs[j-1].End
+		}
+	}
+
+	// Replace rs[i:j] with the merged range, in place.
+	switch n := len(rs) + i + 1 - j; {
+	case n > len(rs):
+		rs = append(rs, keyRange{})
+		copy(rs[i+1:], rs[i:])
+	case n < len(rs):
+		copy(rs[i+1:], rs[j:])
+		for k := n; k < len(rs); k++ {
+			// Don't keep the keys alive.
+			rs[k] = keyRange{}
+		}
+		rs = rs[:n]
+	}
+	rs[i] = keyRange{b, e}
+	*s = rs
+}
+
+// Contains returns whether the key is in the set.
+func (s rangeSet) Contains(k Key) bool {
+	i := sort.Search(len(s), func(i int) bool { return bytes.Compare(s[i].End, k) > 0 })
+	return i < len(s) && bytes.Compare(s[i].Begin, k) <= 0
+}
+
+// IntersectsRange returns whether any key in [b, e) is in the set.
+func (s rangeSet) IntersectsRange(b, e Key) bool {
+	i := sort.Search(len(s), func(i int) bool { return bytes.Compare(s[i].End, b) > 0 })
+	return i < len(s) && bytes.Compare(s[i].Begin, e) < 0
+}
+
+// Intersects returns whether the sets have any key in common.
+func (s rangeSet) Intersects(o rangeSet) bool {
+	for _, r := range o {
+		if s.IntersectsRange(r.Begin, r.End) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package tinyfdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangeSetAdd(t *testing.T) {
+	tsts := []struct {
+		Name   string
+		Ranges []keyRange
+
+		Want rangeSet
+	}{
+		{"empty", nil, nil},
+		{"emptyRange", []keyRange{{Key("b"), Key("b")}}, nil},
+		{"single", []keyRange{{Key("b"), Key("c")}}, rangeSet{{Key("b"), Key("c")}}},
+		{"disjoint", []keyRange{{Key("d"), Key("e")}, {Key("b"), Key("c")}}, rangeSet{{Key("b"), Key("c")}, {Key("d"), Key("e")}}},
+		{"adjacent", []keyRange{{Key("c"), Key("d")}, {Key("b"), Key("c")}}, rangeSet{{Key("b"), Key("d")}}},
+		{"overlapping", []keyRange{{Key("b"), Key("d")}, {Key("c"), Key("e")}}, rangeSet{{Key("b"), Key("e")}}},
+		{"contained", []keyRange{{Key("b"), Key("e")}, {Key("c"), Key("d")}}, rangeSet{{Key("b"), Key("e")}}},
+		{"insertMiddle", []keyRange{{Key("b"), Key("c")}, {Key("f"), Key("g")}, {Key("d"), Key("e")}}, rangeSet{{Key("b"), Key("c")}, {Key("d"), Key("e")}, {Key("f"), Key("g")}}},
+		{"spanning", []keyRange{{Key("b"), Key("c")}, {Key("d"), Key("e")}, {Key("f"), Key("g")}, {Key("a"), Key("e")}}, rangeSet{{Key("a"), Key("e")}, {Key("f"), Key("g")}}},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			var got rangeSet
+			for _, r := range tst.Ranges {
+				got.Add(r.Begin, r.End)
+			}
+
+			if !reflect.DeepEqual(got, tst.Want) {
+				t.Errorf("Add: got %q, want %q", got, tst.Want)
+			}
+		})
+	}
+}
+
+func TestRangeSetContains(t *testing.T) {
+	s := rangeSet{{Key("b"), Key("c")}, {Key("d"), Key("e")}}
+
+	tsts := []struct {
+		Key  Key
+		Want bool
+	}{
+		{Key("a"), false},
+		{Key("b"), true},
+		{Key("b\x00"), true},
+		{Key("c"), false},
+		{Key("d"), true},
+		{Key("e"), false},
+	}
+	for _, tst := range tsts {
+		if got := s.Contains(tst.Key); got != tst.Want {
+			t.Errorf("Contains(%q): got %v, want %v", tst.Key, got, tst.Want)
+		}
+	}
+}
+
+func TestRangeSetIntersects(t *testing.T) {
+	s := rangeSet{{Key("b"), Key("c")}, {Key("d"), Key("e")}}
+
+	tsts := []struct {
+		Name  string
+		Other rangeSet
+		Want  bool
+	}{
+		{"empty", nil, false},
+		{"before", rangeSet{{Key("a"), Key("b")}}, false},
+		{"between", rangeSet{{Key("c"), Key("d")}}, false},
+		{"after", rangeSet{{Key("e"), Key("f")}}, false},
+		{"overlapBegin", rangeSet{{Key("a"), Key("b\x00")}}, true},
+		{"overlapEnd", rangeSet{{Key("d\x00"), Key("f")}}, true},
+		{"spanning", rangeSet{{Key("a"), Key("f")}}, true},
+		{"second", rangeSet{{Key("a"), Key("b")}, {Key("c"), Key("d\x00")}}, true},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			if got := s.Intersects(tst.Other); got != tst.Want {
+				t.Errorf("Intersects(%q): got %v, want %v", tst.Other, got, tst.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tinyfdb
+
+import (
+	"time"
+
+	"github.com/tidwall/btree"
+)
+
+// initialRetryDelay is the backoff delay after the first failed
+// attempt. It doubles for each retry, up to the maximum retry delay.
+const initialRetryDelay = 1 * time.Millisecond
+
+// OnError determines whether the error is retryable. If it is, the
+// transaction is reset, and the returned future becomes ready after a
+// backoff delay. Otherwise, the future returns the error.
+func (t *transaction) OnError(e Error) FutureNil {
+	if !e.retryable() {
+		return &futureNil{err: e}
+	}
+
+	t.waitPending()
+
+	t.mu.Lock()
+	if t.timedOutAt(t.d.clock()) {
+		t.mu.Unlock()
+		return &futureNil{err: errTransactionTimedOut}
+	}
+	if t.opts.retryLimit >= 0 && t.retries >= t.opts.retryLimit {
+		t.mu.Unlock()
+		return &futureNil{err: e}
+	}
+	t.retries++
+	delay := initialRetryDelay << (t.retries - 1)
+	maxDelay := t.opts.maxRetryDelay
+	t.resetLocked()
+	t.mu.Unlock()
+
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay > 0 {
+		// Jitter avoids retrying conflicting transactions in lock-step.
+		t.d.mu.Lock()
+		delay = time.Duration(t.d.rnd.Int63n(int64(delay)) + 1)
+		t.d.mu.Unlock()
+	}
+
+	f := newFutureNil()
+	time.AfterFunc(delay, func() { f.set(nil) })
+	return f
+}
+
+// Reset returns the transaction to its initial state, as if it had
+// just been created. Pending writes are discarded, and the next read
+// gets a new read version.
+func (t *transaction) Reset() {
+	t.waitPending()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resetLocked()
+	t.resetOptionsLocked()
+	t.retries = 0
+}
+
+// resetOptionsLocked restores the options to the database defaults,
+// and restarts the timeout.
+func (t *transaction) resetOptionsLocked() {
+	t.readYourWrites = defaultReadYourWrites()
+	t.accessSystemKeys = false
+	t.readSystemKeys = false
+	t.nextWriteNoWriteConflictRange = false
+
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+
+	t.opts = t.d.txOptions
+	t.start = t.d.now()
+	t.recordStacks = t.d.raceStacks != nil
+}
+
+// timedOutAt returns whether the timeout has elapsed at the given
+// time. Mutex: mu.
+func (t *transaction) timedOutAt(now time.Time) bool {
+	return t.opts.timeout > 0 && now.Sub(t.start) >= t.opts.timeout
+}
+
+// resetLocked discards everything but options, and makes the
+// transaction live again.
+func (t *transaction) resetLocked() {
+	t.versionstamp.set(nil, errTransactionCancelled)
+
+	t.writes = btree.NewNonConcurrent(btreeBefore)
+	t.clears = nil
+	t.vsKeys = nil
+	t.versionstamp = newFutureKey()
+	t.invalid = nil
+	t.cancelled = false
+	t.committing = false
+	t.committedSeq = 0
+
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+
+	t.readSeq = 0
+	t.snap = nil
+	t.readConflicts = nil
+	t.writeConflicts = nil
+	t.conflictStacks = nil
+	t.failWatchesLocked(errTransactionCancelled)
+	t.d.txmap[t] = struct{}{}
+}
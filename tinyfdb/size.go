@@ -0,0 +1,55 @@
+package tinyfdb
+
+const (
+	// keySizeLimit is the maximum size of a key, in bytes.
+	keySizeLimit = 10000
+
+	// valueSizeLimit is the maximum size of a value, in bytes.
+	valueSizeLimit = 100000
+)
+
+// GetApproximateSize returns a future that will become ready with the
+// approximate transaction size so far, in bytes. It is the same size
+// that is compared to the size limit on commit. See
+// TransactionOptions.SetSizeLimit.
+func (t Transaction) GetApproximateSize() FutureInt64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return &futureInt64{v: int64(t.sizeLocked())}
+}
+
+// sizeLocked returns the approximate size of the transaction, in
+// bytes. It counts mutations and conflict ranges. Mutex: mu.
+func (t *transaction) sizeLocked() int {
+	var n int
+	t.writes.Ascend(nil, func(item interface{}) bool {
+		kv := item.(keyValue)
+		n += len(kv.Key) + len(kv.Value)
+		for _, op := range kv.Ops {
+			n += len(kv.Key) + len(op.param)
+		}
+		return true
+	})
+	for _, vk := range t.vsKeys {
+		n += len(vk.Key) + len(vk.Value)
+	}
+	for _, rs := range []rangeSet{t.clears, t.readConflicts, t.writeConflicts} {
+		for _, r := range rs {
+			n += len(r.Begin) + len(r.End)
+		}
+	}
+	return n
+}
+
+// checkWriteSize returns an error if the key or value is too large to
+// be written.
+func checkWriteSize(k Key, v []byte) error {
+	if len(k) > keySizeLimit {
+		return errKeyTooLarge
+	}
+	if len(v) > valueSizeLimit {
+		return errValueTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package tinyfdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionSizeLimits(t *testing.T) {
+	tsts := []struct {
+		Name    string
+		F       func(tx Transaction)
+		WantErr error
+	}{
+		{"keyAtLimit", func(tx Transaction) { tx.Set(make(Key, keySizeLimit), nil) }, nil},
+		{"keyTooLarge", func(tx Transaction) { tx.Set(make(Key, keySizeLimit+1), nil) }, errKeyTooLarge},
+		{"valueAtLimit", func(tx Transaction) { tx.Set(Key("akey"), make([]byte, valueSizeLimit)) }, nil},
+		{"valueTooLarge", func(tx Transaction) { tx.Set(Key("akey"), make([]byte, valueSizeLimit+1)) }, errValueTooLarge},
+		{"atomicKeyTooLarge", func(tx Transaction) { tx.Add(make(Key, keySizeLimit+1), []byte{1}) }, errKeyTooLarge},
+		{"atomicParamTooLarge", func(tx Transaction) { tx.BitOr(Key("akey"), make([]byte, valueSizeLimit+1)) }, errValueTooLarge},
+		{"versionstampedValueTooLarge", func(tx Transaction) {
+			tx.SetVersionstampedValue(Key("akey"), append(make([]byte, valueSizeLimit+1), 0, 0, 0, 0))
+		}, errValueTooLarge},
+		{"versionstampedKeyTooLarge", func(tx Transaction) {
+			tx.SetVersionstampedKey(append(make(Key, keySizeLimit+1), 0, 0, 0, 0), nil)
+		}, errKeyTooLarge},
+		{"clearKeyTooLarge", func(tx Transaction) { tx.Clear(make(Key, keySizeLimit+1)) }, nil},
+		{"transactionTooLarge", func(tx Transaction) {
+			for i := 0; i < defaultSizeLimit/valueSizeLimit; i++ {
+				tx.Set(Key(fmt.Sprint(i)), make([]byte, valueSizeLimit))
+			}
+		}, errTransactionTooLarge},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			tst.F(tx)
+
+			if err := tx.Commit().Get(); !errors.Is(err, tst.WantErr) {
+				t.Errorf("Commit err: got %v, want %v", err, tst.WantErr)
+			}
+		})
+	}
+
+	t.Run("getKeyTooLarge", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		// No such key can exist.
+		got, err := tx.Get(make(Key, keySizeLimit+1)).Get()
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if got != nil {
+			t.Errorf("Get: got %q, want nil", got)
+		}
+	})
+}
+
+func TestTransactionGetApproximateSize(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+
+	if got := tx.GetApproximateSize().MustGet(); got != 0 {
+		t.Errorf("GetApproximateSize: got %v, want 0", got)
+	}
+
+	// Four bytes of key and six of value, plus a conflict range of
+	// four and five bytes.
+	tx.Set(Key("akey"), []byte("avalue"))
+	if got, want := tx.GetApproximateSize().MustGet(), int64(19); got != want {
+		t.Errorf("GetApproximateSize: got %v, want %v", got, want)
+	}
+
+	// A clear range and its conflict range.
+	tx.ClearRange(KeyRange{Key("b"), Key("c")})
+	if got, want := tx.GetApproximateSize().MustGet(), int64(19+4); got != want {
+		t.Errorf("GetApproximateSize(ClearRange): got %v, want %v", got, want)
+	}
+
+	// A read conflict range.
+	tx.Get(Key("dkey")).MustGet()
+	if got, want := tx.GetApproximateSize().MustGet(), int64(19+4+9); got != want {
+		t.Errorf("GetApproximateSize(Get): got %v, want %v", got, want)
+	}
+
+	// The limit applies to the same size.
+	tx.Options().SetSizeLimit(19 + 4 + 9)
+	if err := tx.Commit().Get(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package tinyfdb
+
+// Snapshot is a handle to a transaction snapshot, suitable for
+// performing snapshot reads. Snapshot reads offer a more relaxed
+// isolation level than the default serializable isolation, reducing
+// transaction conflicts but making it harder to reason about
+// concurrency.
+//
+// Snapshot reads use the same read version, and see the same writes,
+// as the transaction, but add no read conflict ranges.
+type Snapshot struct {
+	t *transaction
+}
+
+// Snapshot returns a Snapshot object, suitable for performing
+// snapshot reads.
+func (t Transaction) Snapshot() Snapshot {
+	return Snapshot{t.transaction}
+}
+
+// Snapshot returns the receiver.
+func (s Snapshot) Snapshot() Snapshot { return s }
+
+func (s Snapshot) Get(key KeyConvertible) FutureByteSlice { return s.t.get(key, true) }
+func (s Snapshot) GetDatabase() Database                  { return Database{s.t.d} }
+func (s Snapshot) GetKey(sel Selectable) FutureKey        { return s.t.getKey(sel, true) }
+func (s Snapshot) GetReadVersion() FutureInt64            { return s.t.GetReadVersion() }
+
+func (s Snapshot) GetRange(r Range, opts RangeOptions) RangeResult {
+	return s.t.getRange(r, opts, true)
+}
+
+// ReadTransact runs f inline, like Transaction.ReadTransact.
+func (s Snapshot) ReadTransact(f func(ReadTransaction) (interface{}, error)) (ret interface{}, err error) {
+	defer panicToError(&err)
+
+	return f(s)
+}
+
+// snapshotRangeResultTx makes range reads of a transaction without
+// adding read conflict ranges.
+type snapshotRangeResultTx struct {
+	*transaction
+}
+
+func (snapshotRangeResultTx) addReadConflictRange(b, e Key) {}
+
+var (
+	_ ReadTransaction = Transaction{}
+	_ ReadTransaction = Snapshot{}
+)
@@ -0,0 +1,83 @@
+package tinyfdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("noReadConflicts", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key("akey"), Seq: 1, Value: []byte("avalue")})
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		ss := tx.Snapshot()
+
+		got, err := ss.Get(Key("akey")).Get()
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if want := []byte("avalue"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get: got %q, want %q", got, want)
+		}
+
+		ri := ss.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{}).Iterator()
+		for ri.Advance() {
+			if _, err := ri.Get(); err != nil {
+				t.Fatalf("RangeIterator.Get failed: %v", err)
+			}
+		}
+
+		if _, err := ss.GetKey(FirstGreaterOrEqual(Key("a"))).Get(); err != nil {
+			t.Fatalf("GetKey failed: %v", err)
+		}
+
+		if tx.readConflicts != nil {
+			t.Errorf("readConflicts: got %+v, want nil", tx.readConflicts)
+		}
+
+		tx.Set(Key("bkey"), []byte("bvalue"))
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key("akey"), []byte("anewervalue"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Errorf("Commit failed: %v", err)
+		}
+	})
+
+	t.Run("readYourWrites", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key("akey"), []byte("avalue"))
+
+			got, err := tx.Snapshot().Get(Key("akey")).Get()
+			if err != nil {
+				return nil, err
+			}
+			if want := []byte("avalue"); !reflect.DeepEqual(got, want) {
+				t.Errorf("Get: got %q, want %q", got, want)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package tinyfdb
+
+// streamingModeBytes are the byte targets of range read batches, per
+// streaming mode, as in the FoundationDB client. Zero is unlimited. A
+// batch ends with the key-value pair that reaches the target.
+var streamingModeBytes = map[StreamingMode]int{
+	StreamingModeWantAll: 80000,
+	StreamingModeExact:   0,
+	StreamingModeSmall:   256,
+	StreamingModeMedium:  1000,
+	StreamingModeLarge:   4096,
+	StreamingModeSerial:  80000,
+}
+
+// iteratorModeBytes are the byte targets of StreamingModeIterator
+// batches. Each batch is 1.5 times larger than the previous, up to the
+// last target.
+var iteratorModeBytes = []int{4096, 6144, 9216, 13824, 20736, 31104, 46656, 69984, 80000, 120000}
+
+// batchLimits returns the row and byte limits of the iteration'th
+// batch of a range read, starting at one. Zero is unlimited.
+func batchLimits(mode StreamingMode, iteration int, limit int) (int, int, error) {
+	if mode == StreamingModeIterator {
+		if iteration > len(iteratorModeBytes) {
+			iteration = len(iteratorModeBytes)
+		}
+		return limit, iteratorModeBytes[iteration-1], nil
+	}
+
+	bytes, ok := streamingModeBytes[mode]
+	if !ok {
+		return 0, 0, errClientInvalidOperation
+	}
+	if mode == StreamingModeExact && limit <= 0 {
+		return 0, 0, errExactModeWithoutLimits
+	}
+	return limit, bytes, nil
+}
+
+// RangeBatchStats are counters of the batches read by range reads.
+type RangeBatchStats struct {
+	Batches int // The number of batches read.
+	Rows    int // The number of key-value pairs in the batches.
+	Bytes   int // The size of keys and values in the batches.
+}
+
+// RangeBatchStats returns the counters of range read batches since
+// the database was opened, or the counters were reset.
+func (d *DBDebug) RangeBatchStats() RangeBatchStats {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	return dd.rangeBatches
+}
+
+// ResetRangeBatchStats sets the counters of range read batches to
+// zero.
+func (d *DBDebug) ResetRangeBatchStats() {
+	dd := (*database)(d)
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.rangeBatches = RangeBatchStats{}
+}
+
+func (t *transaction) countRangeBatch(rows, bytes int) {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+
+	t.d.rangeBatches.Batches++
+	t.d.rangeBatches.Rows += rows
+	t.d.rangeBatches.Bytes += bytes
+}
@@ -0,0 +1,177 @@
+package tinyfdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRangeIteratorStreamingMode(t *testing.T) {
+	// Each key-value pair is ten bytes.
+	const numKeys = 1005
+	newDB := func(t *testing.T) Database {
+		t.Helper()
+
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			for i := 0; i < numKeys; i++ {
+				tx.Set(Key(fmt.Sprintf("k%04d", i)), []byte("value"))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+		db.Debug().ResetRangeBatchStats()
+		return db
+	}
+
+	tsts := []struct {
+		Name  string
+		Mode  StreamingMode
+		Limit int
+
+		Want RangeBatchStats
+	}{
+		{"iterator", StreamingModeIterator, 0, RangeBatchStats{Batches: 2, Rows: numKeys, Bytes: 10 * numKeys}},
+		{"iteratorLimit", StreamingModeIterator, 300, RangeBatchStats{Batches: 1, Rows: 300, Bytes: 3000}},
+		{"wantAll", StreamingModeWantAll, 0, RangeBatchStats{Batches: 1, Rows: numKeys, Bytes: 10 * numKeys}},
+		{"exact", StreamingModeExact, 300, RangeBatchStats{Batches: 1, Rows: 300, Bytes: 3000}},
+		{"small", StreamingModeSmall, 0, RangeBatchStats{Batches: 39, Rows: numKeys, Bytes: 10 * numKeys}},
+		{"medium", StreamingModeMedium, 0, RangeBatchStats{Batches: 11, Rows: numKeys, Bytes: 10 * numKeys}},
+		{"large", StreamingModeLarge, 0, RangeBatchStats{Batches: 3, Rows: numKeys, Bytes: 10 * numKeys}},
+		{"serial", StreamingModeSerial, 0, RangeBatchStats{Batches: 1, Rows: numKeys, Bytes: 10 * numKeys}},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db := newDB(t)
+
+			n := 0
+			_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+				it := tx.GetRange(KeyRange{Key("k"), Key("l")}, RangeOptions{Limit: tst.Limit, Mode: tst.Mode}).Iterator()
+				for it.Advance() {
+					it.MustGet()
+					n++
+				}
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("ReadTransact failed: %v", err)
+			}
+
+			if n != tst.Want.Rows {
+				t.Errorf("Advance: got %d keys, want %d", n, tst.Want.Rows)
+			}
+			if got := db.Debug().RangeBatchStats(); got != tst.Want {
+				t.Errorf("RangeBatchStats: got %+v, want %+v", got, tst.Want)
+			}
+		})
+	}
+
+	t.Run("getSliceWantAll", func(t *testing.T) {
+		db := newDB(t)
+
+		_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			return tx.GetRange(KeyRange{Key("k"), Key("l")}, RangeOptions{}).GetSliceWithError()
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+
+		want := RangeBatchStats{Batches: 1, Rows: numKeys, Bytes: 10 * numKeys}
+		if got := db.Debug().RangeBatchStats(); got != want {
+			t.Errorf("RangeBatchStats: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("getSliceExact", func(t *testing.T) {
+		db := newDB(t)
+
+		// The mode is ignored.
+		_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			return tx.GetRange(KeyRange{Key("k"), Key("l")}, RangeOptions{Limit: 300, Mode: StreamingModeSmall}).GetSliceWithError()
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+
+		want := RangeBatchStats{Batches: 1, Rows: 300, Bytes: 3000}
+		if got := db.Debug().RangeBatchStats(); got != want {
+			t.Errorf("RangeBatchStats: got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		db := newDB(t)
+
+		tsts := []struct {
+			Name string
+			Opts RangeOptions
+
+			WantErr error
+		}{
+			{"exactWithoutLimit", RangeOptions{Mode: StreamingModeExact}, errExactModeWithoutLimits},
+			{"unknownMode", RangeOptions{Mode: StreamingMode(42)}, errClientInvalidOperation},
+		}
+		for _, tst := range tsts {
+			t.Run(tst.Name, func(t *testing.T) {
+				_, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+					it := tx.GetRange(KeyRange{Key("k"), Key("l")}, tst.Opts).Iterator()
+					for it.Advance() {
+						if _, err := it.Get(); err != nil {
+							return nil, err
+						}
+					}
+					return nil, nil
+				})
+				if !errors.Is(err, tst.WantErr) {
+					t.Errorf("Get err: got %v, want %v", err, tst.WantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("conflictsCoverBatch", func(t *testing.T) {
+		tsts := []struct {
+			Name string
+			Key  Key
+
+			WantErr error
+		}{
+			// The first batch in StreamingModeSmall is 26 keys.
+			{"inBatch", Key("k0020"), errNotCommitted},
+			{"afterBatch", Key("k0100"), nil},
+		}
+		for _, tst := range tsts {
+			t.Run(tst.Name, func(t *testing.T) {
+				db := newDB(t)
+
+				tx, err := db.CreateTransaction()
+				if err != nil {
+					t.Fatalf("CreateTransaction failed: %v", err)
+				}
+				it := tx.GetRange(KeyRange{Key("k"), Key("l")}, RangeOptions{Mode: StreamingModeSmall}).Iterator()
+				if !it.Advance() {
+					t.Fatalf("Advance: got false, want true")
+				}
+				it.MustGet()
+				tx.Set(Key("other"), []byte("value"))
+
+				_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+					tx.Set(tst.Key, []byte("newvalue"))
+					return nil, nil
+				})
+				if err != nil {
+					t.Fatalf("Transact failed: %v", err)
+				}
+
+				if err := tx.Commit().Get(); !errors.Is(err, tst.WantErr) {
+					t.Errorf("Commit err: got %v, want %v", err, tst.WantErr)
+				}
+			})
+		}
+	})
+}
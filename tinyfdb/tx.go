@@ -1,268 +1,783 @@
 package tinyfdb
 
 import (
-	"fmt"
+	"bytes"
+	"math"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tidwall/btree"
 	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
 )
 
 // Transaction is a lightweight handle of a transaction. It is cheap
-// to copy, and all copies point to the same transaction. Instances
-// are goroutine-compatible, but not goroutine-safe.
+// to copy, and all copies point to the same transaction. Like in
+// FoundationDB, a transaction can be used from many goroutines at
+// once.
 type Transaction struct {
 	*transaction
 }
 
-func (t Transaction) Cancel()           { t.transaction.Cancel() }
-func (t Transaction) Commit() FutureNil { return t.transaction.Commit() }
+func (t Transaction) AddReadConflictKey(key KeyConvertible) error {
+	return t.transaction.AddReadConflictKey(key)
+}
+func (t Transaction) AddReadConflictRange(er ExactRange) error {
+	return t.transaction.AddReadConflictRange(er)
+}
+func (t Transaction) AddWriteConflictKey(key KeyConvertible) error {
+	return t.transaction.AddWriteConflictKey(key)
+}
+func (t Transaction) AddWriteConflictRange(er ExactRange) error {
+	return t.transaction.AddWriteConflictRange(er)
+}
 
-func (t Transaction) Get(key KeyConvertible) FutureByteSlice { return t.transaction.Get(key) }
+func (t Transaction) Cancel()                  { t.transaction.Cancel() }
+func (t Transaction) Clear(key KeyConvertible) { t.transaction.Clear(key) }
+func (t Transaction) Commit() FutureNil        { return t.transaction.Commit() }
+
+func (t Transaction) Get(key KeyConvertible) FutureByteSlice { return t.transaction.get(key, false) }
+func (t Transaction) GetDatabase() Database                  { return Database{t.d} }
+func (t Transaction) GetKey(sel Selectable) FutureKey        { return t.transaction.getKey(sel, false) }
+func (t Transaction) GetReadVersion() FutureInt64            { return t.transaction.GetReadVersion() }
+func (t Transaction) OnError(e Error) FutureNil              { return t.transaction.OnError(e) }
+func (t Transaction) Reset()                                 { t.transaction.Reset() }
 
 func (t Transaction) GetRange(r Range, opts RangeOptions) RangeResult {
-	return t.transaction.GetRange(r, opts)
+	return t.transaction.getRange(r, opts, false)
 }
 
 func (t Transaction) Set(key KeyConvertible, value []byte) { t.transaction.Set(key, value) }
+func (t Transaction) Watch(key KeyConvertible) FutureNil   { return t.transaction.Watch(key) }
+
+// Transact runs f inline, without committing, so transactional
+// functions can be composed. The caller is responsible for
+// committing and retrying. An Error panic in f is returned as an
+// error.
+func (t Transaction) Transact(f func(Transaction) (interface{}, error)) (ret interface{}, err error) {
+	defer panicToError(&err)
+
+	return f(t)
+}
+
+// ReadTransact runs f inline, like Transact.
+func (t Transaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (ret interface{}, err error) {
+	defer panicToError(&err)
+
+	return f(t)
+}
 
 type transaction struct {
 	d *database
 
-	mu          sync.Mutex
-	taints      map[string]taintType // Mutex: d.mu
-	taintStacks map[string][]string  // Mutex: d.mu
-	writes      *btree.BTree
-	readSeq     uint64
+	// mu guards the transaction state. Reads only need a read
+	// lock, so they can run in parallel.
+	mu      sync.RWMutex
+	pending pendingOps   // All asynchronous operations.
+	reads   pendingOps   // Asynchronous reads, which Commit waits for.
+	writes  *btree.BTree // keyValue with pendingSeq. Mutex: mu
+	clears  rangeSet     // Mutex: mu
+	readSeq uint64       // Mutex: mu, and d.mu for writes
+	snap    *btree.BTree // Committed versions, from the first read. Mutex: mu
+
+	readConflicts  rangeSet        // Mutex: mu
+	writeConflicts rangeSet        // Mutex: mu
+	conflictStacks []conflictStack // Mutex: mu
+	recordStacks   bool            // Record conflictStacks. Mutex: mu
+	watches        []*watch        // Mutex: d.mu
+
+	// Options. See TransactionOptions. Mutex: mu
+	opts                          transactionOptions
+	readYourWrites                bool
+	accessSystemKeys              bool
+	readSystemKeys                bool
+	nextWriteNoWriteConflictRange bool
+	start                         time.Time // For the timeout. Mutex: mu
+
+	vsKeys       []versionstampedKey // Mutex: mu
+	versionstamp *futureKey          // Mutex: mu
+	invalid      error               // Mutex: mu
+	cancelled    bool                // Mutex: mu
+	committing   bool                // Commit has been called. Mutex: mu
+	retries      int                 // Mutex: mu
+	committedSeq uint64              // Mutex: mu
 }
 
-type taintType int
+// pendingSeq is the sequence number used for keys in
+// `transaction.writes`. It sorts after all committed versions of the
+// same key, so a write shadows the committed value when merged.
+const pendingSeq = uint64(math.MaxUint64)
 
-const (
-	noTaint   taintType = 0
-	readTaint taintType = 1 << iota
-	writeTaint
-	conflictTaint
-)
+// maxKey is the beginning of the system keyspace. Normal keys sort
+// before it.
+var maxKey = Key{0xFF}
 
-func (t taintType) String() string {
-	switch t {
-	case noTaint:
-		return "-"
-	case readTaint:
-		return "read"
-	case writeTaint:
-		return "write"
-	case conflictTaint:
-		return "conflict"
-	default:
-		return "<unknown>"
-	}
-}
+// systemKeyLimit is the end of the system keyspace. System keys sort
+// before it.
+var systemKeyLimit = Key{0xFF, 0xFF}
 
 func newTransaction(d *database) *transaction {
-	return &transaction{
-		d:           d,
-		taints:      map[string]taintType{},
-		taintStacks: map[string][]string{},
-		writes:      btree.NewNonConcurrent(btreeBefore),
+	t := &transaction{
+		d:            d,
+		writes:       btree.NewNonConcurrent(btreeBefore),
+		versionstamp: newFutureKey(),
 	}
+	t.resetOptionsLocked()
+	return t
 }
 
+// defaultReadYourWrites returns whether read-your-writes is enabled
+// for new transactions. It is the default since API version 300.
+func defaultReadYourWrites() bool {
+	v, err := internal.GetAPIVersion()
+	return err != nil || v >= 300
+}
+
+// Cancel cancels the transaction. Outstanding and later operations
+// fail with transaction_cancelled, as does Commit, until the
+// transaction is reset.
 func (t *transaction) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancelled = true
+	t.invalid = errTransactionCancelled
+
 	t.d.mu.Lock()
 	defer t.d.mu.Unlock()
 
 	delete(t.d.txmap, t)
+	t.versionstamp.set(nil, errTransactionCancelled)
+	t.failWatchesLocked(errTransactionCancelled)
 }
 
+// Commit commits the transaction asynchronously. Outstanding reads
+// complete first, so their read conflict ranges are included.
 func (t *transaction) Commit() FutureNil {
 	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	if t.writes.Len() == 0 {
-		t.Cancel()
-		return &futureNil{}
+	if err := t.writeErrLocked(); err != nil {
+		t.setInvalidLocked(err)
+		t.mu.Unlock()
+		return &futureNil{err: err}
 	}
+	t.committing = true
+	t.mu.Unlock()
+
+	f := newFutureNil()
+	t.goAsync(DebugCommit, &f.futureBase, func() {
+		t.waitReads()
+		t.readWatchValues()
+		f.set(t.commit())
+	})
+	return f
+}
+
+func (t *transaction) commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
 	t.d.mu.Lock()
 	defer t.d.mu.Unlock()
 
-	for key, taint := range t.taints {
-		if taint&conflictTaint == 0 {
-			continue
-		}
-		if taint&^conflictTaint != 0 {
-			var k interface{} = []byte(key)
-			if kt, err := internal.UnpackTuple([]byte(key)); err == nil {
-				k = kt
-			}
+	if t.invalid == nil && t.timedOutAt(t.d.now()) {
+		t.invalid = errTransactionTimedOut
+	}
+	if t.invalid == nil && t.readSeq != 0 && t.d.tooOldLocked(t.readSeq) {
+		t.invalid = errTransactionTooOld
+	}
+	if t.invalid == nil && t.sizeLocked() > t.opts.sizeLimit {
+		t.invalid = errTransactionTooLarge
+	}
+	if t.invalid != nil {
+		t.versionstamp.set(nil, t.invalid)
+		t.failWatchesLocked(t.invalid)
+		return t.invalid
+	}
 
-			if t.d.raceStacks != nil {
-				fmt.Fprintf(t.d.raceStacks, "*** TinyFDB Races for key %+v ***\n", k)
-				for _, stack := range t.taintStacks[key] {
-					fmt.Fprintln(t.d.raceStacks, "Race", stack)
-				}
-			}
+	if t.writes.Len() == 0 && len(t.clears) == 0 && len(t.vsKeys) == 0 && len(t.writeConflicts) == 0 {
+		t.versionstamp.set(nil, errNoCommitVersion)
+		t.activateWatchesLocked()
+		delete(t.d.txmap, t)
+		return nil
+	}
 
-			return &futureNil{err: RetryableError{fmt.Errorf("write race for key %+v", k)}}
-		}
+	if err := t.checkConflictsLocked(); err != nil {
+		t.versionstamp.set(nil, err)
+		t.failWatchesLocked(err)
+		return err
 	}
 
-	for key, taint := range t.taints {
-		if taint&writeTaint == 0 {
-			continue
+	t.d.prevSeq = t.d.nextVersionLocked()
+	t.committedSeq = t.d.prevSeq
+	vs := makeVersionstamp(t.d.prevSeq)
+
+	var vsKeys []keyValue
+	for _, vk := range t.vsKeys {
+		kv := vk.keyValue
+		// The offset was validated when the key was added.
+		kv.Key, _ = placeVersionstamp(kv.Key, vs, false)
+		kv.Seq = t.d.prevSeq
+		vsKeys = append(vsKeys, kv)
+		if !vk.noWriteConflict {
+			t.addConflictRangeLocked(&t.writeConflicts, "write", kv.Key, keyAfter(kv.Key), 0)
 		}
-		for t2 := range t.d.txmap {
-			if t2 == t {
-				continue
+	}
+	t.recordCommitLocked(t.d.prevSeq)
+
+	// Clears happened before any of the writes.
+	var cleared []keyValue
+	for _, r := range t.clears {
+		t.d.bt.Descend(keyValue{Key: r.End}, func(item interface{}) bool {
+			kv := item.(keyValue)
+			if bytes.Compare(kv.Key, r.Begin) < 0 {
+				return false
 			}
-			t2.taints[key] |= conflictTaint
-			if t.d.raceStacks != nil {
-				t2.taintStacks[key] = append(t2.taintStacks[key], t.taintStacks[key]...)
+			if len(cleared) > 0 && bytes.Equal(cleared[len(cleared)-1].Key, kv.Key) {
+				// An older version.
+				return true
 			}
-		}
+			cleared = append(cleared, keyValue{Key: kv.Key, Seq: t.d.prevSeq, Value: kv.Value})
+			return true
+		})
 	}
-
-	t.d.prevSeq++
-	if t.d.prevSeq == 0 {
-		panic(fmt.Errorf("tinyfdb/database.prevSeq wrapped around"))
+	for _, kv := range cleared {
+		if kv.Value != nil {
+			kv.Value = nil
+			t.d.bt.Set(kv)
+			t.d.enqueueCompactionLocked(kv.Key, kv.Seq)
+		}
 	}
 
 	var hint btree.PathHint
 	t.writes.Ascend(nil, func(item interface{}) bool {
 		kv := item.(keyValue)
-		kv.Key = append(append(internal.Tuple{}, kv.Key...), t.d.prevSeq)
+		if kv.Ops != nil {
+			kv.Value = applyMutations(t.d.latestLocked(kv.Key), kv.Ops, vs)
+			kv.Ops = nil
+		}
+		kv.Seq = t.d.prevSeq
 		t.d.bt.SetHint(kv, &hint)
+		t.d.enqueueCompactionLocked(kv.Key, kv.Seq)
 		return true
 	})
+	for _, kv := range vsKeys {
+		t.d.bt.Set(kv)
+		t.d.enqueueCompactionLocked(kv.Key, kv.Seq)
+	}
+
+	t.versionstamp.set(vs, nil)
+	t.d.fireWatchesLocked(func(k Key) bool {
+		if t.clears.Contains(k) || t.writes.Get(keyValue{Key: k, Seq: pendingSeq}) != nil {
+			return true
+		}
+		for _, kv := range vsKeys {
+			if bytes.Equal(kv.Key, k) {
+				return true
+			}
+		}
+		return false
+	})
+	t.activateWatchesLocked()
 
 	delete(t.d.txmap, t)
+	t.d.compactLocked()
+
+	return nil
+}
 
-	return &futureNil{}
+// Clear removes the key, if it exists. It is the same as a
+// `ClearRange` of only the key.
+func (t *transaction) Clear(key KeyConvertible) {
+	k := key.FDBKey()
+	t.ClearRange(KeyRange{k, append(k[:len(k):len(k)], 0)})
 }
 
 func (t *transaction) ClearRange(er ExactRange) {
 	b, e := er.FDBRangeKeys()
-
-	bb, err := internal.UnpackTuple(b.FDBKey())
-	if err != nil {
+	bk := append(Key(nil), b.FDBKey()...)
+	ek := append(Key(nil), e.FDBKey()...)
+	if bytes.Compare(bk, ek) > 0 {
+		t.setInvalid(errInvertedRange)
 		return
 	}
 
-	ee, err := internal.UnpackTuple(e.FDBKey())
-	if err != nil {
-		return
+	t.write(bk, ek, func() {
+		// Earlier writes are overridden by the clear.
+		var pending []keyValue
+		t.writes.Ascend(keyValue{Key: bk}, func(item interface{}) bool {
+			kv := item.(keyValue)
+			if bytes.Compare(kv.Key, ek) >= 0 {
+				return false
+			}
+			pending = append(pending, kv)
+			return true
+		})
+		for _, kv := range pending {
+			t.writes.Delete(kv)
+		}
+		t.clears.Add(bk, ek)
+	})
+}
+
+// get reads the value of a key. Snapshot reads add no read
+// conflict range.
+func (t *transaction) get(key KeyConvertible, snapshot bool) FutureByteSlice {
+	k := append(Key(nil), key.FDBKey()...)
+	if t.isCancelled() {
+		return &futureByteSlice{err: errTransactionCancelled}
+	}
+	if bytes.Compare(k, t.keyLimit(false)) >= 0 {
+		return &futureByteSlice{err: errKeyOutsideLegalRange}
+	}
+	if len(k) > keySizeLimit {
+		// No such key can exist.
+		return &futureByteSlice{}
 	}
 
-	t.ascend(bb, func(kv keyValue) bool {
-		// t.d.mu already locked.
+	// Pending writes are resolved when the read is issued, so later
+	// writes don't affect it.
+	ops, f := t.getPending(k)
+	if f != nil {
+		return f
+	}
 
-		c, err := kv.Key[:len(kv.Key)-1].Cmp(ee)
-		if err != nil {
-			panic(err)
+	f = newFutureByteSlice()
+	t.goAsync(DebugGet, &f.futureBase, func() { f.set(t.getCommitted(k, ops, snapshot)) })
+	return f
+}
+
+// getPending looks up a pending write of the key. If it determines
+// the value, a ready future is returned. Otherwise, deferred
+// mutations to apply on the committed value are returned.
+func (t *transaction) getPending(k Key) ([]mutation, *futureByteSlice) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if !t.readYourWrites {
+		return nil, nil
+	}
+	if item := t.writes.Get(keyValue{Key: k, Seq: pendingSeq}); item != nil {
+		kv := item.(keyValue)
+		if kv.Ops == nil {
+			// Reading our own writes doesn't cause conflicts.
+			return nil, &futureByteSlice{bs: kv.Value}
 		}
-		if c >= 0 {
-			return false
+		if hasVersionstamp(kv.Ops) {
+			return nil, &futureByteSlice{err: errAccessedUnreadable}
 		}
-		k := kv.Key[:len(kv.Key)-1]
-		kbs := k.Pack()
-		if kv.Value != nil {
-			t.writes.Set(keyValue{k, nil})
-			t.setTaintLocked(kbs, writeTaint, 0)
-		} else {
-			// A tombstone means we shouldn't taint this. We may have
-			// done so on earlier versions already. Conflicts with
-			// other transactions must be preserved.
-			t.writes.Delete(keyValue{k, nil})
-			taint := t.taints[string(kbs)] & ^(readTaint | writeTaint)
-			if taint == 0 {
-				delete(t.taints, string(kbs))
-			} else {
-				t.taints[string(kbs)] = taint
-			}
+		return kv.Ops, nil
+	}
+	if t.clears.Contains(k) {
+		return nil, &futureByteSlice{}
+	}
+	return nil, nil
+}
+
+// getCommitted reads the committed value of a key, and applies the
+// pending mutations.
+func (t *transaction) getCommitted(k Key, ops []mutation, snapshot bool) ([]byte, error) {
+	var found *keyValue
+	err := t.descendCommitted(keyValue{Key: k, Seq: pendingSeq}, func(kv keyValue) bool {
+		if bytes.Equal(kv.Key, k) {
+			found = &kv
 		}
-		return true
+		return false
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !snapshot {
+		// Reading a missing key also conflicts, if the key is
+		// created by another transaction.
+		t.addReadConflictRange(k, keyAfter(k))
+	}
+
+	if found == nil {
+		return applyMutations(nil, ops, nil), nil
+	}
+	return applyMutations(found.Value, ops, nil), nil
 }
 
-func (t *transaction) Get(key KeyConvertible) FutureByteSlice {
-	k, err := internal.UnpackTuple(key.FDBKey())
-	if err != nil {
-		return &futureByteSlice{err: err}
+func (t *transaction) getRange(r Range, opts RangeOptions, snapshot bool) RangeResult {
+	bs, es := r.FDBRangeKeySelectors()
+	begin, end := bs.FDBKeySelector(), es.FDBKeySelector()
+	if _, err := t.getReadSeq(); err != nil {
+		return RangeResult{err: err}
+	}
+	if lim := t.keyLimit(false); bytes.Compare(begin.Key.FDBKey(), lim) > 0 || bytes.Compare(end.Key.FDBKey(), lim) > 0 {
+		return RangeResult{err: errKeyOutsideLegalRange}
 	}
 
-	var found *keyValue
-	var ferr error
-	t.ascend(k, func(kv keyValue) bool {
-		c, err := kv.Key[:len(kv.Key)-1].Cmp(k)
+	// The iterator resolves FirstGreater* selectors lazily. Others
+	// are resolved up front.
+	if begin.Offset != 1 {
+		k, err := t.resolveKeySelector(begin, t.copyWriteView(), snapshot)
 		if err != nil {
-			ferr = err
-			return false
+			return RangeResult{err: err}
 		}
-		if c != 0 {
-			return false
+		begin = FirstGreaterOrEqual(k)
+	}
+	if end.Offset != 1 {
+		k, err := t.resolveKeySelector(end, t.copyWriteView(), snapshot)
+		if err != nil {
+			return RangeResult{err: err}
 		}
-		found = &kv
-		return true
-	})
+		end = FirstGreaterOrEqual(k)
+	}
+
+	if snapshot {
+		return newRangeResult(snapshotRangeResultTx{t}, begin, end, opts)
+	}
+	return newRangeResult(t, begin, end, opts)
+}
+
+func (t *transaction) getKey(sel Selectable, snapshot bool) FutureKey {
+	ks := sel.FDBKeySelector()
+	ks.Key = append(Key(nil), ks.Key.FDBKey()...)
+
+	// Pending writes are captured when the read is issued, so later
+	// writes don't affect it.
+	w := t.copyWriteView()
+	f := newFutureKey()
+	t.goAsync(DebugGet, &f.futureBase, func() { f.set(t.resolveKeySelector(ks, w, snapshot)) })
+	return f
+}
+
+// resolveKeySelector returns the key the selector points to. If it
+// resolves to before the first key, the empty key is returned. If it
+// resolves to after the last key, "\xff" is returned ("\xff\xff" if
+// system keys can be read). Unless this is a snapshot read, the keys
+// that were skipped are added as a read conflict range.
+func (t *transaction) resolveKeySelector(ks KeySelector, w writeView, snapshot bool) (Key, error) {
+	k := ks.Key.FDBKey()
+	sel := keySelector{Key: k, OrEqual: ks.OrEqual, Offset: ks.Offset}
+	lim := t.keyLimit(false)
+
+	v, err := t.getReadView()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *keyValue
+	if ks.Offset > 0 {
+		// The Offset:th key after k.
+		n := ks.Offset
+		w.ascendLive(v, keyValue{Key: k}, func(kv keyValue) bool {
+			if bytes.Compare(kv.Key, lim) >= 0 {
+				return false
+			}
+			if c := bytes.Compare(kv.Key, k); c < 0 || (c == 0 && ks.OrEqual) {
+				return true
+			}
+			n--
+			if n == 0 {
+				found = &kv
+			}
+			return n > 0
+		})
+	} else {
+		// The (1-Offset):th key before k.
+		n := 1 - ks.Offset
+		w.descendLive(v, keyValue{Key: k, Seq: pendingSeq}, func(kv keyValue) bool {
+			if bytes.Compare(kv.Key, lim) >= 0 {
+				return true
+			}
+			if c := bytes.Compare(kv.Key, k); c > 0 || (c == 0 && !ks.OrEqual) {
+				return true
+			}
+			n--
+			if n == 0 {
+				found = &kv
+			}
+			return n > 0
+		})
+	}
 
-	if ferr != nil {
-		return &futureByteSlice{err: ferr}
+	if ks.Offset > 0 {
+		if found == nil {
+			// Clamped to the end of the keyspace.
+			if !snapshot {
+				t.addReadConflictRange(sel.conflictKey(), lim)
+			}
+			return append(Key(nil), lim...), nil
+		}
+		if !snapshot {
+			t.addReadConflictRange(sel.conflictKey(), keyAfter(found.Key))
+		}
+		return append(Key(nil), found.Key...), nil
 	}
+
 	if found == nil {
-		return &futureByteSlice{}
+		// Clamped to the beginning of the keyspace.
+		if !snapshot {
+			t.addReadConflictRange(nil, sel.conflictKey())
+		}
+		return Key{}, nil
+	}
+	if !snapshot {
+		t.addReadConflictRange(found.Key, sel.conflictKey())
 	}
-	t.setTaint(found.Key.Pack(), readTaint)
-	return &futureByteSlice{bs: found.Value}
+	return append(Key(nil), found.Key...), nil
 }
 
-func (t *transaction) GetRange(r Range, opts RangeOptions) RangeResult {
-	begin, end := r.FDBRangeKeySelectors()
-	t.getReadSeq()
-	return newRangeResult(t, begin.FDBKeySelector(), end.FDBKeySelector(), opts)
+// getReadSeq returns the version the transaction reads at. The
+// first call gets the latest committed version, unless one was set
+// using SetReadVersion.
+func (t *transaction) getReadSeq() (uint64, error) {
+	v, err := t.getReadView()
+	return v.seq, err
 }
 
-func (t *transaction) getReadSeq() uint64 {
+// getReadView returns the committed versions the transaction reads.
+// The first call takes a snapshot of the database, which later reads
+// use without holding the database lock.
+func (t *transaction) getReadView() (readView, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.readSeq == 0 {
-		t.d.mu.Lock()
-		defer t.d.mu.Unlock()
+	if t.cancelled {
+		return readView{}, errTransactionCancelled
+	}
 
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+
+	if t.timedOutAt(t.d.now()) {
+		return readView{}, errTransactionTimedOut
+	}
+	t.d.advanceVersionLocked()
+	if t.readSeq == 0 {
 		t.readSeq = t.d.prevSeq
 	}
-	return t.readSeq
+	if t.readSeq > t.d.prevSeq {
+		return readView{}, errFutureVersion
+	}
+	if t.d.tooOldLocked(t.readSeq) {
+		return readView{}, errTransactionTooOld
+	}
+	if t.snap == nil {
+		t.snap = t.d.snapshotLocked()
+	}
+	return readView{t.snap, t.readSeq}, nil
 }
 
-func (t *transaction) ascend(pivot internal.Tuple, fun func(keyValue) bool) {
-	seq := t.getReadSeq()
+// ascend calls fun for each version of each key, starting at
+// pivot. If read-your-writes is enabled, pending writes are included
+// as the latest version of their keys.
+func (t *transaction) ascend(pivot keyValue, fun func(keyValue) bool) error {
+	v, err := t.getReadView()
+	if err != nil {
+		return err
+	}
 
-	t.d.mu.Lock()
-	defer t.d.mu.Unlock()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-	t.d.bt.Ascend(pivot, func(item interface{}) bool {
-		kv := item.(keyValue)
-		if kv.Key[len(kv.Key)-1].(uint64) > seq {
-			return true
+	t.writeViewLocked().ascend(v, pivot, fun)
+	return nil
+}
+
+// descend is the reverse of ascend.
+func (t *transaction) descend(pivot keyValue, fun func(keyValue) bool) error {
+	v, err := t.getReadView()
+	if err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.writeViewLocked().descend(v, pivot, fun)
+	return nil
+}
+
+// isTombstone returns whether the version means the key doesn't
+// exist.
+func isTombstone(kv keyValue) bool {
+	return kv.Value == nil && kv.Ops == nil
+}
+
+// A writeView is the pending writes a read sees. It is empty if
+// read-your-writes is disabled.
+type writeView struct {
+	writes *btree.BTree
+	clears rangeSet
+}
+
+// writeViewLocked returns the current pending writes. They may only
+// be used while mu is held.
+func (t *transaction) writeViewLocked() writeView {
+	if !t.readYourWrites {
+		return writeView{}
+	}
+	return writeView{t.writes, t.clears}
+}
+
+// copyWriteView returns a copy of the pending writes, for a read that
+// completes asynchronously. Writes made after the read was issued
+// don't affect it.
+func (t *transaction) copyWriteView() writeView {
+	// Copy modifies the source tree.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.readYourWrites {
+		return writeView{}
+	}
+	return writeView{t.writes.Copy(), append(rangeSet(nil), t.clears...)}
+}
+
+// ascend calls fun for each committed version visible at v, merged
+// with the pending writes, starting at pivot.
+func (w writeView) ascend(v readView, pivot keyValue, fun func(keyValue) bool) {
+	if w.writes == nil {
+		v.ascend(pivot, fun)
+		return
+	}
+
+	p, pok := btreeNext(w.writes, pivot, true)
+	stopped := false
+	v.ascend(pivot, func(kv keyValue) bool {
+		for pok && btreeBefore(p, kv) {
+			if stopped = !fun(resolveWrite(v, p)); stopped {
+				return false
+			}
+			p, pok = btreeNext(w.writes, p, false)
+		}
+		if w.clears.Contains(kv.Key) {
+			kv.Value = nil
 		}
+		stopped = !fun(kv)
+		return !stopped
+	})
+	for pok && !stopped {
+		stopped = !fun(resolveWrite(v, p))
+		p, pok = btreeNext(w.writes, p, false)
+	}
+}
 
+// descend is the reverse of ascend.
+func (w writeView) descend(v readView, pivot keyValue, fun func(keyValue) bool) {
+	if w.writes == nil {
+		v.descend(pivot, fun)
+		return
+	}
+
+	p, pok := btreePrev(w.writes, pivot, true)
+	stopped := false
+	v.descend(pivot, func(kv keyValue) bool {
+		for pok && btreeBefore(kv, p) {
+			if stopped = !fun(resolveWrite(v, p)); stopped {
+				return false
+			}
+			p, pok = btreePrev(w.writes, p, false)
+		}
+		if w.clears.Contains(kv.Key) {
+			kv.Value = nil
+		}
+		stopped = !fun(kv)
+		return !stopped
+	})
+	for pok && !stopped {
+		stopped = !fun(resolveWrite(v, p))
+		p, pok = btreePrev(w.writes, p, false)
+	}
+}
+
+// ascendLive calls fun for the latest version of each key, starting
+// at pivot. Keys whose latest version is a tombstone are skipped.
+func (w writeView) ascendLive(v readView, pivot keyValue, fun func(keyValue) bool) {
+	var cur *keyValue
+	stopped := false
+	w.ascend(v, pivot, func(kv keyValue) bool {
+		if cur != nil && !bytes.Equal(cur.Key, kv.Key) && !isTombstone(*cur) {
+			if stopped = !fun(*cur); stopped {
+				return false
+			}
+		}
+		cur = &kv
+		return true
+	})
+	if !stopped && cur != nil && !isTombstone(*cur) {
+		fun(*cur)
+	}
+}
+
+// descendLive is the reverse of ascendLive.
+func (w writeView) descendLive(v readView, pivot keyValue, fun func(keyValue) bool) {
+	var prev *keyValue
+	w.descend(v, pivot, func(kv keyValue) bool {
+		if prev != nil && bytes.Equal(prev.Key, kv.Key) {
+			// An older version.
+			return true
+		}
+		prev = &kv
+		if isTombstone(kv) {
+			return true
+		}
 		return fun(kv)
 	})
 }
 
-func (t *transaction) descend(pivot internal.Tuple, fun func(keyValue) bool) {
-	seq := t.getReadSeq()
+// resolveWrite applies any deferred mutations in the pending write to
+// the committed value. Versionstamped values cannot be resolved, and
+// keep their Ops.
+func resolveWrite(v readView, kv keyValue) keyValue {
+	if kv.Ops == nil || hasVersionstamp(kv.Ops) {
+		return kv
+	}
 
-	t.d.mu.Lock()
-	defer t.d.mu.Unlock()
+	var prev []byte
+	v.descend(keyValue{Key: kv.Key, Seq: pendingSeq}, func(pkv keyValue) bool {
+		if bytes.Equal(pkv.Key, kv.Key) {
+			prev = pkv.Value
+		}
+		return false
+	})
+	kv.Value = applyMutations(prev, kv.Ops, nil)
+	kv.Ops = nil
+	return kv
+}
+
+// descendCommitted calls fun for each committed version visible to
+// the transaction, in descending order, starting at pivot.
+func (t *transaction) descendCommitted(pivot keyValue, fun func(keyValue) bool) error {
+	v, err := t.getReadView()
+	if err != nil {
+		return err
+	}
+
+	v.descend(pivot, fun)
+	return nil
+}
 
-	t.d.bt.Descend(pivot, func(item interface{}) bool {
+// A readView is the committed versions visible at a read version. The
+// btree is an immutable snapshot, so no lock is needed.
+type readView struct {
+	bt  *btree.BTree
+	seq uint64
+}
+
+// ascend calls fun for each version visible at the read version,
+// starting at pivot.
+func (v readView) ascend(pivot keyValue, fun func(keyValue) bool) {
+	v.bt.Ascend(pivot, func(item interface{}) bool {
 		kv := item.(keyValue)
-		if kv.Key[len(kv.Key)-1].(uint64) > seq {
+		if kv.Seq > v.seq {
+			return true
+		}
+
+		return fun(kv)
+	})
+}
+
+// descend is the reverse of ascend.
+func (v readView) descend(pivot keyValue, fun func(keyValue) bool) {
+	v.bt.Descend(pivot, func(item interface{}) bool {
+		kv := item.(keyValue)
+		if kv.Seq > v.seq {
 			return true
 		}
 
@@ -271,30 +786,79 @@ func (t *transaction) descend(pivot internal.Tuple, fun func(keyValue) bool) {
 }
 
 func (t *transaction) Set(key KeyConvertible, value []byte) {
-	k := key.FDBKey()
-	t.setTaint(k, writeTaint)
+	k := append(Key(nil), key.FDBKey()...)
+	if err := checkWriteSize(k, value); err != nil {
+		t.setInvalid(err)
+		return
+	}
 
-	kt, err := internal.UnpackTuple(k)
-	if err != nil {
-		panic(err)
+	t.write(k, keyAfter(k), func() {
+		// A nil value is a tombstone, so make sure we always store
+		// a slice.
+		t.writes.Set(keyValue{Key: k, Seq: pendingSeq, Value: append([]byte{}, value...)})
+	})
+}
+
+// write checks that [b, e) may be written, and adds it as a write
+// conflict range, unless the write was exempted using
+// SetNextWriteNoWriteConflictRange. It then calls apply with mu held,
+// to change the pending writes. If the range is outside the legal
+// keyspace, the transaction is made invalid, and apply is not called.
+func (t *transaction) write(b, e Key, apply func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.writeErrLocked(); err != nil {
+		t.setInvalidLocked(err)
+		return
+	}
+	if bytes.Compare(e, t.keyLimitLocked(true)) > 0 {
+		t.setInvalidLocked(errKeyOutsideLegalRange)
+		return
+	}
+	if t.nextWriteNoWriteConflictRange {
+		t.nextWriteNoWriteConflictRange = false
+	} else {
+		t.addConflictRangeLocked(&t.writeConflicts, "write", b, e, 1)
+	}
+
+	apply()
+}
+
+// writeErrLocked returns an error if the transaction can't be
+// modified, because it was cancelled, or Commit has been called.
+func (t *transaction) writeErrLocked() error {
+	if t.cancelled {
+		return errTransactionCancelled
+	}
+	if t.committing {
+		return errUsedDuringCommit
 	}
-	t.writes.Set(keyValue{kt, value})
+	return nil
 }
 
-func (t *transaction) setTaint(key []byte, typ taintType) {
-	t.d.mu.Lock()
-	t.setTaintLocked(key, typ, 1)
-	t.d.mu.Unlock()
+// isCancelled returns whether the transaction was cancelled.
+func (t *transaction) isCancelled() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.cancelled
 }
 
-func (t *transaction) setTaintLocked(key []byte, typ taintType, stackSkip int) {
-	sk := string(key)
+// keyLimit returns the end of the keyspace the transaction can read
+// or write. Keys sort before it.
+func (t *transaction) keyLimit(write bool) Key {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 
-	t.taints[sk] |= typ
+	return t.keyLimitLocked(write)
+}
 
-	if t.d.raceStacks != nil {
-		t.taintStacks[sk] = append(t.taintStacks[sk], fmt.Sprintf("%s in %s", typ & ^conflictTaint, stackTrace(1+stackSkip)))
+func (t *transaction) keyLimitLocked(write bool) Key {
+	if t.accessSystemKeys || (!write && t.readSystemKeys) {
+		return systemKeyLimit
 	}
+	return maxKey
 }
 
 func stackTrace(skip int) string {
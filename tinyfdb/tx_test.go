@@ -2,7 +2,9 @@ package tinyfdb
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
@@ -35,6 +37,8 @@ func TestTransactionCommit(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
+		freezeClock(db)
+
 		wantValue := []byte("avalue")
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
 			tx.Set(Key(internal.Tuple{"akey"}.Pack()), wantValue)
@@ -53,9 +57,9 @@ func TestTransactionCommit(t *testing.T) {
 			t.Errorf("Set Len: got %v, want %v", got, want)
 		}
 
-		wantKey := internal.Tuple{"akey", uint64(2)}
-		got := db.bt.Get(wantKey)
-		if !reflect.DeepEqual(got, keyValue{wantKey, wantValue}) {
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
+		got := db.bt.Get(keyValue{Key: wantKey, Seq: 2})
+		if !reflect.DeepEqual(got, keyValue{Key: wantKey, Seq: 2, Value: wantValue}) {
 			t.Errorf("Set Get: got %v, want %v", got, wantValue)
 		}
 	})
@@ -66,6 +70,8 @@ func TestTransactionCommit(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
+		freezeClock(db)
+
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
 			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("anoldvalue"))
 			return nil, nil
@@ -92,19 +98,60 @@ func TestTransactionCommit(t *testing.T) {
 			t.Errorf("Set Len: got %v, want %v", got, want)
 		}
 
-		wantKey := internal.Tuple{"akey", uint64(3)}
-		got := db.bt.Get(wantKey)
-		if !reflect.DeepEqual(got, keyValue{wantKey, wantValue}) {
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
+		got := db.bt.Get(keyValue{Key: wantKey, Seq: 3})
+		if !reflect.DeepEqual(got, keyValue{Key: wantKey, Seq: 3, Value: wantValue}) {
 			t.Errorf("Set Get: got %v, want %v", got, wantValue)
 		}
 	})
 
-	t.Run("failsWriteTaint", func(t *testing.T) {
+	t.Run("failsReadConflict", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if _, err := tx.Get(Key(internal.Tuple{"akey"}.Pack())).Get(); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("avalue"))
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("anewervalue"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		// This will fail to commit because akey was written by the
+		// other transaction after we read it.
+		if err := tx.Commit().Get(); !errors.Is(err, errNotCommitted) {
+			t.Fatalf("Commit err: got %v, want %v", err, errNotCommitted)
+		}
+
+		db.bt.Ascend(nil, func(item interface{}) bool {
+			t.Logf("Item: %+v", item)
+			return true
+		})
+
+		if got, want := db.bt.Len(), 1; got != want {
+			t.Errorf("Set Len: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("blindWrites", func(t *testing.T) {
 		db, err := OpenDefault()
 		if err != nil {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
+		freezeClock(db)
+
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
 			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("avalue"))
 
@@ -117,19 +164,405 @@ func TestTransactionCommit(t *testing.T) {
 			}
 			return nil, nil
 		})
-		// This will fail to commit because akey was tainted by the
-		// inner transaction.
-		if !errors.Is(err, RetryableError{}) {
-			t.Fatalf("Transact(two) err: got %#v, want RetryableError", err)
+		// Writes without reads don't conflict, and the last commit
+		// wins.
+		if err != nil {
+			t.Fatalf("Transact(two) failed: %v", err)
 		}
 
-		db.bt.Ascend(nil, func(item interface{}) bool {
-			t.Logf("Item: %+v", item)
-			return true
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
+		got := db.bt.Get(keyValue{Key: wantKey, Seq: 3})
+		if !reflect.DeepEqual(got, keyValue{Key: wantKey, Seq: 3, Value: []byte("avalue")}) {
+			t.Errorf("Set Get: got %v, want %v", got, "avalue")
+		}
+	})
+
+	t.Run("failsPhantomRead", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		// The range is empty, but inserting into it conflicts.
+		ri := tx.GetRange(mustPrefixRange([]byte("a")), RangeOptions{}).Iterator()
+		for ri.Advance() {
+			if _, err := ri.Get(); err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+		}
+		tx.Set(Key("bkey"), []byte("bvalue"))
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key("akey"), []byte("avalue"))
+			return nil, nil
 		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
 
-		if got, want := db.bt.Len(), 1; got != want {
-			t.Errorf("Set Len: got %v, want %v", got, want)
+		if err := tx.Commit().Get(); !errors.Is(err, errNotCommitted) {
+			t.Fatalf("Commit err: got %v, want %v", err, errNotCommitted)
+		}
+	})
+
+	t.Run("limitedRead", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key("a1"), Seq: 1, Value: []byte("avalue")})
+		db.bt.Set(keyValue{Key: Key("a3"), Seq: 1, Value: []byte("avalue")})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			// Only the range up to the limit is read.
+			ri := tx.GetRange(mustPrefixRange([]byte("a")), RangeOptions{Limit: 1}).Iterator()
+			for ri.Advance() {
+				if _, err := ri.Get(); err != nil {
+					return nil, err
+				}
+			}
+			tx.Set(Key("bkey"), []byte("bvalue"))
+
+			_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+				tx.Set(Key("a2"), []byte("avalue"))
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("Transact(one) failed: %v", err)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact(two) failed: %v", err)
+		}
+	})
+}
+
+func TestTransactionOnError(t *testing.T) {
+	t.Run("retryable", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if _, err := tx.Get(Key("akey")).Get(); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+		tx.Cancel()
+
+		if err := tx.OnError(errNotCommitted).Get(); err != nil {
+			t.Fatalf("OnError failed: %v", err)
+		}
+
+		if tx.readSeq != 0 {
+			t.Errorf("OnError readSeq: got %v, want 0", tx.readSeq)
+		}
+		if tx.writes.Len() != 0 {
+			t.Errorf("OnError writes: got %v, want 0", tx.writes.Len())
+		}
+		if tx.readConflicts != nil || tx.writeConflicts != nil {
+			t.Errorf("OnError conflicts: got %+v, %+v, want nil", tx.readConflicts, tx.writeConflicts)
+		}
+		if _, ok := db.txmap[tx.transaction]; !ok {
+			t.Errorf("txmap: transaction not registered: %v", db.txmap)
+		}
+	})
+
+	t.Run("notRetryable", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+
+		wantErr := errClientInvalidOperation
+		if err := tx.OnError(wantErr).Get(); !errors.Is(err, wantErr) {
+			t.Fatalf("OnError err: got %v, want %v", err, wantErr)
+		}
+
+		// The transaction is left intact.
+		if tx.writes.Len() != 1 {
+			t.Errorf("OnError writes: got %v, want 1", tx.writes.Len())
+		}
+	})
+}
+
+func TestTransactionReset(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+	tx.Set(Key("akey"), []byte("avalue"))
+	tx.Reset()
+
+	if err := tx.Commit().Get(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if got := db.bt.Len(); got != 0 {
+		t.Errorf("Len: got %v, want 0", got)
+	}
+}
+
+func TestTransactionCancel(t *testing.T) {
+	tsts := []struct {
+		Name string
+		F    func(tx Transaction) error
+	}{
+		{"get", func(tx Transaction) error { _, err := tx.Get(Key("akey")).Get(); return err }},
+		{"getOwnWrite", func(tx Transaction) error { _, err := tx.Get(Key("bkey")).Get(); return err }},
+		{"getKey", func(tx Transaction) error { _, err := tx.GetKey(FirstGreaterOrEqual(Key("a"))).Get(); return err }},
+		{"getRange", func(tx Transaction) error {
+			it := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{}).Iterator()
+			it.Advance()
+			_, err := it.Get()
+			return err
+		}},
+		{"getSliceWithError", func(tx Transaction) error {
+			_, err := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{}).GetSliceWithError()
+			return err
+		}},
+		{"getReadVersion", func(tx Transaction) error { _, err := tx.GetReadVersion().Get(); return err }},
+		{"set", func(tx Transaction) error { tx.Set(Key("akey"), []byte("avalue")); return tx.Commit().Get() }},
+		{"addWriteConflictKey", func(tx Transaction) error { return tx.AddWriteConflictKey(Key("akey")) }},
+		{"commit", func(tx Transaction) error { return tx.Commit().Get() }},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			tx.Set(Key("bkey"), []byte("bvalue"))
+			tx.Cancel()
+
+			if err := tst.F(tx); !errors.Is(err, errTransactionCancelled) {
+				t.Errorf("err: got %v, want %v", err, errTransactionCancelled)
+			}
+			if got := db.bt.Len(); got != 0 {
+				t.Errorf("Len: got %v, want 0", got)
+			}
+		})
+	}
+
+	t.Run("reset", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Cancel()
+		tx.Reset()
+
+		tx.Set(Key("akey"), []byte("avalue"))
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	})
+}
+
+func TestTransactionUsedDuringCommit(t *testing.T) {
+	tsts := []struct {
+		Name string
+		F    func(tx Transaction) error
+	}{
+		{"set", func(tx Transaction) error { tx.Set(Key("bkey"), []byte("bvalue")); return tx.Commit().Get() }},
+		{"clear", func(tx Transaction) error { tx.Clear(Key("akey")); return tx.Commit().Get() }},
+		{"add", func(tx Transaction) error { tx.Add(Key("akey"), []byte{1}); return tx.Commit().Get() }},
+		{"setVersionstampedKey", func(tx Transaction) error {
+			tx.SetVersionstampedKey(append(make(Key, 10), 0, 0, 0, 0), nil)
+			return tx.Commit().Get()
+		}},
+		{"addWriteConflictKey", func(tx Transaction) error { return tx.AddWriteConflictKey(Key("akey")) }},
+		{"commit", func(tx Transaction) error { return tx.Commit().Get() }},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			tx.Set(Key("akey"), []byte("avalue"))
+			if err := tx.Commit().Get(); err != nil {
+				t.Fatalf("Commit failed: %v", err)
+			}
+
+			if err := tst.F(tx); !errors.Is(err, errUsedDuringCommit) {
+				t.Errorf("err: got %v, want %v", err, errUsedDuringCommit)
+			}
+			if got := db.bt.Len(); got != 1 {
+				t.Errorf("Len: got %v, want 1", got)
+			}
+
+			// Reads are still allowed.
+			if got, err := tx.Get(Key("akey")).Get(); err != nil || string(got) != "avalue" {
+				t.Errorf("Get: got %q, %v, want %q", got, err, "avalue")
+			}
+		})
+	}
+}
+
+func TestTransactionConcurrentUse(t *testing.T) {
+	const (
+		numGoroutines = 8
+		numIterations = 50
+	)
+
+	// getCounter returns the value of a counter written by
+	// Transaction.Add.
+	getCounter := func(t *testing.T, db Database) int {
+		t.Helper()
+
+		v, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			return tx.Get(Key("counter")).Get()
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+		bs := make([]byte, 2)
+		copy(bs, v.([]byte))
+		return int(bs[0]) | int(bs[1])<<8
+	}
+
+	t.Run("oneTransaction", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < numGoroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+
+				for i := 0; i < numIterations; i++ {
+					k := Key(fmt.Sprintf("b%d-%d", g, i))
+					tx.Set(k, []byte("bvalue"))
+					tx.Add(Key("counter"), []byte{1, 0})
+					if got := tx.Get(k).MustGet(); string(got) != "bvalue" {
+						t.Errorf("Get(%q): got %q, want %q", k, got, "bvalue")
+					}
+					if got := tx.Snapshot().Get(Key("akey")).MustGet(); string(got) != "avalue" {
+						t.Errorf("Get(akey): got %q, want %q", got, "avalue")
+					}
+					tx.GetKey(FirstGreaterOrEqual(Key("a"))).MustGet()
+					it := tx.GetRange(KeyRange{Key("a"), Key("c")}, RangeOptions{Limit: 10}).Iterator()
+					for it.Advance() {
+						if _, err := it.Get(); err != nil {
+							t.Errorf("GetRange failed: %v", err)
+						}
+					}
+					tx.GetReadVersion().MustGet()
+					tx.GetApproximateSize().MustGet()
+					if i%2 == 0 {
+						tx.Clear(k)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		if got, want := getCounter(t, db), numGoroutines*numIterations; got != want {
+			t.Errorf("counter: got %v, want %v", got, want)
+		}
+		n, err := db.ReadTransact(func(tx ReadTransaction) (interface{}, error) {
+			kvs := 0
+			it := tx.GetRange(KeyRange{Key("b"), Key("c")}, RangeOptions{}).Iterator()
+			for it.Advance() {
+				if _, err := it.Get(); err != nil {
+					return nil, err
+				}
+				kvs++
+			}
+			return kvs, nil
+		})
+		if err != nil {
+			t.Fatalf("ReadTransact failed: %v", err)
+		}
+		if want := numGoroutines * numIterations / 2; n != want {
+			t.Errorf("GetRange: got %v keys, want %v", n, want)
+		}
+	})
+
+	t.Run("transact", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < numGoroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < numIterations; i++ {
+					_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+						tx.Options().SetRetryLimit(-1)
+
+						// Reading makes concurrent increments conflict.
+						bs := make([]byte, 2)
+						copy(bs, tx.Get(Key("counter")).MustGet())
+						v := int(bs[0]) | int(bs[1])<<8 + 1
+						tx.Set(Key("counter"), []byte{byte(v), byte(v >> 8)})
+						return nil, nil
+					})
+					if err != nil {
+						t.Errorf("Transact failed: %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got, want := getCounter(t, db), numGoroutines*numIterations; got != want {
+			t.Errorf("counter: got %v, want %v", got, want)
 		}
 	})
 }
@@ -140,10 +573,11 @@ func TestTransactionClearRange(t *testing.T) {
 		t.Fatalf("OpenDefault failed: %v", err)
 	}
 
-	db.bt.Set(keyValue{internal.Tuple{1, uint64(1)}, []byte("value1")})
-	db.bt.Set(keyValue{internal.Tuple{2, uint64(1)}, []byte("value2")})
-	db.bt.Set(keyValue{internal.Tuple{3, uint64(1)}, nil}) // A tombstone.
-	db.bt.Set(keyValue{internal.Tuple{4, uint64(1)}, []byte("value3")})
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{1}.Pack()), Seq: 1, Value: []byte("value1")})
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{2}.Pack()), Seq: 1, Value: []byte("value2")})
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{3}.Pack()), Seq: 1}) // A tombstone.
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{4}.Pack()), Seq: 1, Value: []byte("value3")})
+	freezeClock(db)
 	db.prevSeq = 1
 
 	_, err = db.Transact(func(tx Transaction) (interface{}, error) {
@@ -152,8 +586,8 @@ func TestTransactionClearRange(t *testing.T) {
 			Key(internal.Tuple{4}.Pack()),
 		})
 
-		if want := map[string]taintType{string(internal.Tuple{2}.Pack()): writeTaint}; !reflect.DeepEqual(tx.taints, want) {
-			t.Errorf("ClearRange taints: got %+v, want %+v", tx.taints, want)
+		if want := (rangeSet{{Key(internal.Tuple{2}.Pack()), Key(internal.Tuple{4}.Pack())}}); !reflect.DeepEqual(tx.writeConflicts, want) {
+			t.Errorf("ClearRange writeConflicts: got %+v, want %+v", tx.writeConflicts, want)
 		}
 
 		return nil, nil
@@ -172,6 +606,73 @@ func TestTransactionClearRange(t *testing.T) {
 	}
 }
 
+func TestTransactionClearRangeInverted(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+	tx.ClearRange(KeyRange{Key("b"), Key("a")})
+
+	if err := tx.Commit().Get(); !errors.Is(err, errInvertedRange) {
+		t.Errorf("Commit err: got %v, want %v", err, errInvertedRange)
+	}
+}
+
+func TestTransactionClear(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	freezeClock(db)
+
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{1}.Pack()), Seq: 1, Value: []byte("value1")})
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{2}.Pack()), Seq: 1, Value: []byte("value2")})
+	db.bt.Set(keyValue{Key: Key(internal.Tuple{3}.Pack()), Seq: 1}) // A tombstone.
+	freezeClock(db)
+	db.prevSeq = 1
+
+	_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+		tx.Clear(Key(internal.Tuple{2}.Pack()))
+		tx.Clear(Key(internal.Tuple{3}.Pack()))
+		tx.Set(Key(internal.Tuple{4}.Pack()), []byte("value4"))
+		tx.Clear(Key(internal.Tuple{4}.Pack()))
+
+		var want rangeSet
+		for _, i := range []int{2, 3, 4} {
+			k := Key(internal.Tuple{i}.Pack())
+			want.Add(k, keyAfter(k))
+		}
+		if !reflect.DeepEqual(tx.writeConflicts, want) {
+			t.Errorf("Clear writeConflicts: got %+v, want %+v", tx.writeConflicts, want)
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	db.bt.Ascend(nil, func(item interface{}) bool {
+		t.Logf("Item: %+v", item)
+		return true
+	})
+
+	if got, want := db.bt.Len(), 4; got != want {
+		t.Errorf("Clear Len: got %v, want %v", got, want)
+	}
+
+	want := keyValue{Key: Key(internal.Tuple{2}.Pack()), Seq: 2}
+	if got := db.bt.Get(want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Clear Get: got %+v, want %+v", got, want)
+	}
+}
+
 func TestTransactionSet(t *testing.T) {
 	t.Run("overwrites", func(t *testing.T) {
 		db, err := OpenDefault()
@@ -179,6 +680,8 @@ func TestTransactionSet(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
+		freezeClock(db)
+
 		wantValue := []byte("anewervalue")
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
 			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("avalue"))
@@ -198,9 +701,9 @@ func TestTransactionSet(t *testing.T) {
 			t.Errorf("Set Len: got %v, want %v", got, want)
 		}
 
-		wantKey := internal.Tuple{"akey", uint64(2)}
-		got := db.bt.Get(wantKey)
-		if !reflect.DeepEqual(got, keyValue{wantKey, wantValue}) {
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
+		got := db.bt.Get(keyValue{Key: wantKey, Seq: 2})
+		if !reflect.DeepEqual(got, keyValue{Key: wantKey, Seq: 2, Value: wantValue}) {
 			t.Errorf("Set Get: got %v, want %v", got, wantValue)
 		}
 	})
@@ -239,24 +742,25 @@ func TestTransactionGet(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
-		wantKey := internal.Tuple{"akey", uint64(2)}
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
 		wantValue := []byte("anewervalue")
-		db.bt.Set(keyValue{internal.Tuple{"akey", uint64(1)}, []byte("avalue")})
-		db.bt.Set(keyValue{wantKey, wantValue})
-		db.bt.Set(keyValue{internal.Tuple{"akey", uint64(3)}, []byte("anewestvalue")})
+		db.bt.Set(keyValue{Key: wantKey, Seq: 1, Value: []byte("avalue")})
+		db.bt.Set(keyValue{Key: wantKey, Seq: 2, Value: wantValue})
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 3, Value: []byte("anewestvalue")})
+		freezeClock(db)
 		db.prevSeq = 2
 
 		var got []byte
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
-			fbs := tx.Get(Key(wantKey[:1].Pack()))
+			fbs := tx.Get(wantKey)
 			bs, err := fbs.Get()
 			if err != nil {
 				return nil, err
 			}
 			got = bs
 
-			if want := map[string]taintType{string(wantKey.Pack()): readTaint}; !reflect.DeepEqual(tx.taints, want) {
-				t.Errorf("Get taints: got %+v, want %+v", tx.taints, want)
+			if want := (rangeSet{{wantKey, keyAfter(wantKey)}}); !reflect.DeepEqual(tx.readConflicts, want) {
+				t.Errorf("Get readConflicts: got %+v, want %+v", tx.readConflicts, want)
 			}
 
 			return nil, nil
@@ -276,7 +780,7 @@ func TestTransactionGet(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
-		db.bt.Set(keyValue{internal.Tuple{"akey", uint64(1)}, []byte("avalue")})
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 1, Value: []byte("avalue")})
 
 		var got []byte
 		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
@@ -287,8 +791,10 @@ func TestTransactionGet(t *testing.T) {
 			}
 			got = bs
 
-			if want := map[string]taintType{}; !reflect.DeepEqual(tx.taints, want) {
-				t.Errorf("Get taints: got %+v, want %+v", tx.taints, want)
+			// A missing key is still read.
+			wantKey := Key(internal.Tuple{"anotherkey"}.Pack())
+			if want := (rangeSet{{wantKey, keyAfter(wantKey)}}); !reflect.DeepEqual(tx.readConflicts, want) {
+				t.Errorf("Get readConflicts: got %+v, want %+v", tx.readConflicts, want)
 			}
 
 			return nil, nil
@@ -303,7 +809,113 @@ func TestTransactionGet(t *testing.T) {
 	})
 }
 
+func TestTransactionGetKey(t *testing.T) {
+	tsts := []struct {
+		Name string
+		Sel  KeySelector
+
+		Want          Key
+		WantConflicts rangeSet
+	}{
+		{"firstGreaterOrEqual", FirstGreaterOrEqual(Key("b")), Key("b"), rangeSet{{Key("b"), Key("b\x00")}}},
+		{"firstGreaterThan", FirstGreaterThan(Key("b")), Key("e"), rangeSet{{Key("b\x00"), Key("e\x00")}}},
+		{"lastLessThan", LastLessThan(Key("b")), Key("a"), rangeSet{{Key("a"), Key("b")}}},
+		{"lastLessOrEqual", LastLessOrEqual(Key("c")), Key("b"), rangeSet{{Key("b"), Key("c\x00")}}},
+		{"offset", KeySelector{Key("a"), false, 3}, Key("e"), rangeSet{{Key("a"), Key("e\x00")}}},
+		{"negativeOffset", KeySelector{Key("e"), false, -1}, Key("a"), rangeSet{{Key("a"), Key("e")}}},
+		{"afterLast", FirstGreaterThan(Key("e")), Key("\xff"), rangeSet{{Key("e\x00"), Key("\xff")}}},
+		{"afterLastOffset", KeySelector{Key("a"), false, 5}, Key("\xff"), rangeSet{{Key("a"), Key("\xff")}}},
+		{"largeNegativeOffset", KeySelector{Key("e"), false, -5}, Key{}, rangeSet{{nil, Key("e")}}},
+		{"skipsSystemKeys", LastLessThan(Key("\xff\x01")), Key("e"), rangeSet{{Key("e"), Key("\xff\x01")}}},
+		{"beforeFirst", LastLessThan(Key("a")), Key{}, rangeSet{{nil, Key("a")}}},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			db.bt.Set(keyValue{Key: Key("a"), Seq: 1, Value: []byte("avalue")})
+			db.bt.Set(keyValue{Key: Key("b"), Seq: 1, Value: []byte("bvalue")})
+			db.bt.Set(keyValue{Key: Key("c"), Seq: 1, Value: []byte("cvalue")})
+			db.bt.Set(keyValue{Key: Key("c"), Seq: 2}) // A tombstone.
+			db.bt.Set(keyValue{Key: Key("\xff"), Seq: 1, Value: []byte("system")})
+			freezeClock(db)
+			db.prevSeq = 2
+
+			_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+				tx.Set(Key("e"), []byte("evalue"))
+				tx.Set(Key("d"), []byte("dvalue"))
+				tx.Clear(Key("d"))
+
+				got, err := tx.GetKey(tst.Sel).Get()
+				if err != nil {
+					return nil, err
+				}
+				if !reflect.DeepEqual(got, tst.Want) {
+					t.Errorf("GetKey: got %q, want %q", got, tst.Want)
+				}
+
+				if !reflect.DeepEqual(tx.readConflicts, tst.WantConflicts) {
+					t.Errorf("GetKey readConflicts: got %q, want %q", tx.readConflicts, tst.WantConflicts)
+				}
+
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("Transact failed: %v", err)
+			}
+		})
+	}
+}
+
 func TestTransactionGetRange(t *testing.T) {
+	t.Run("selectors", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		for _, k := range []string{"a", "b", "c", "d"} {
+			db.bt.Set(keyValue{Key: Key(k), Seq: 1, Value: []byte(k)})
+		}
+
+		for _, tst := range []struct {
+			Name  string
+			Range SelectorRange
+			Opts  RangeOptions
+			Want  []string
+		}{
+			{"lastLessThan", SelectorRange{LastLessThan(Key("b")), FirstGreaterOrEqual(Key("c"))}, RangeOptions{}, []string{"a", "b"}},
+			{"lastLessOrEqual", SelectorRange{LastLessOrEqual(Key("b")), LastLessOrEqual(Key("c"))}, RangeOptions{}, []string{"b"}},
+			{"offset", SelectorRange{KeySelector{Key("a"), false, 2}, KeySelector{Key("a"), false, 4}}, RangeOptions{}, []string{"b", "c"}},
+			{"reverseOffset", SelectorRange{KeySelector{Key("d"), false, -2}, KeySelector{Key("d"), false, 0}}, RangeOptions{Reverse: true}, []string{"b", "a"}},
+		} {
+			t.Run(tst.Name, func(t *testing.T) {
+				tx, err := db.CreateTransaction()
+				if err != nil {
+					t.Fatalf("CreateTransaction failed: %v", err)
+				}
+				defer tx.Cancel()
+
+				var got []string
+				ri := tx.GetRange(tst.Range, tst.Opts).Iterator()
+				for ri.Advance() {
+					kv, err := ri.Get()
+					if err != nil {
+						t.Fatalf("Get failed: %v", err)
+					}
+					got = append(got, string(kv.Key))
+				}
+
+				if !reflect.DeepEqual(got, tst.Want) {
+					t.Errorf("GetRange: got %q, want %q", got, tst.Want)
+				}
+			})
+		}
+	})
+
 	t.Run("empty", func(t *testing.T) {
 		db, err := OpenDefault()
 		if err != nil {
@@ -339,9 +951,10 @@ func TestTransactionGetRange(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
-		wantKey := internal.Tuple{"akey", uint64(2)}
+		wantKey := Key(internal.Tuple{"akey"}.Pack())
 		wantValue := []byte("anewervalue")
-		db.bt.Set(keyValue{wantKey, wantValue})
+		db.bt.Set(keyValue{Key: wantKey, Seq: 2, Value: wantValue})
+		freezeClock(db)
 		db.prevSeq = 2
 
 		var got []KeyValue
@@ -362,7 +975,7 @@ func TestTransactionGetRange(t *testing.T) {
 		}
 
 		want := []KeyValue{
-			{wantKey[:1].Pack(), wantValue},
+			{wantKey, wantValue},
 		}
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("GetRange: got %v, want %v", got, want)
@@ -375,7 +988,8 @@ func TestTransactionGetRange(t *testing.T) {
 			t.Fatalf("OpenDefault failed: %v", err)
 		}
 
-		db.bt.Set(keyValue{internal.Tuple{"akey", uint64(2)}, []byte("anewervalue")})
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 2, Value: []byte("anewervalue")})
+		freezeClock(db)
 		db.prevSeq = 2
 
 		var got []KeyValue
@@ -402,27 +1016,110 @@ func TestTransactionGetRange(t *testing.T) {
 			t.Errorf("GetRange: got %v, want %v", got, want)
 		}
 	})
+
+	t.Run("manyBatches", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		// Two versions of each key, and pending writes in every
+		// other batch.
+		const numKeys = 2 * rangeBatchSize
+		for i := 0; i < numKeys; i++ {
+			k := fmt.Sprintf("a%04d", i)
+			db.bt.Set(keyValue{Key: Key(k), Seq: 1, Value: []byte("old")})
+			db.bt.Set(keyValue{Key: Key(k), Seq: 2, Value: []byte("value")})
+		}
+		freezeClock(db)
+		db.prevSeq = 2
+
+		for _, reverse := range []bool{false, true} {
+			t.Run(fmt.Sprint(reverse), func(t *testing.T) {
+				tx, err := db.CreateTransaction()
+				if err != nil {
+					t.Fatalf("CreateTransaction failed: %v", err)
+				}
+				defer tx.Cancel()
+
+				tx.Set(Key("a0000p"), []byte("pending"))
+				tx.Set(Key(fmt.Sprintf("a%04dp", rangeBatchSize)), []byte("pending"))
+				tx.Clear(Key(fmt.Sprintf("a%04d", numKeys-1)))
+
+				var got []string
+				ri := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{Reverse: reverse}).Iterator()
+				for ri.Advance() {
+					kv, err := ri.Get()
+					if err != nil {
+						t.Fatalf("Get failed: %v", err)
+					}
+					got = append(got, string(kv.Key)+"="+string(kv.Value))
+				}
+
+				// The last key was cleared.
+				var want []string
+				for i := 0; i < numKeys-1; i++ {
+					k := fmt.Sprintf("a%04d", i)
+					want = append(want, k+"=value")
+					if i == 0 || i == rangeBatchSize {
+						want = append(want, k+"p=pending")
+					}
+				}
+				if reverse {
+					for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+						want[i], want[j] = want[j], want[i]
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("GetRange: got %d keys, want %d", len(got), len(want))
+				}
+			})
+		}
+	})
+
+	t.Run("snapshotIsolation", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		commitValue(t, db, Key("akey"), []byte("avalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		defer tx.Cancel()
+		ri := tx.GetRange(KeyRange{Key("a"), Key("c")}, RangeOptions{}).Iterator()
+		if !ri.Advance() {
+			t.Fatalf("Advance: got false, want true")
+		}
+
+		// Commits after the read version are not visible.
+		commitValue(t, db, Key("bkey"), []byte("bvalue"))
+		if ri.Advance() {
+			kv, _ := ri.Get()
+			t.Errorf("Advance: got %q, want false", kv.Key)
+		}
+	})
 }
 
 func TestTransactionAscend(t *testing.T) {
-	makeKey := func(k byte, seq uint64) internal.Tuple {
-		return internal.Tuple{[]byte{k}, seq}
-	}
-	makeKey2 := func(k byte, seq uint64) internal.Tuple {
-		return makeKey(k, seq)[:1]
+	makeKey := func(k byte, seq uint64) keyValue {
+		return keyValue{Key: Key{k}, Seq: seq, Value: []byte("anewervalue")}
 	}
 
 	tsts := []struct {
 		Name  string
-		Pivot internal.Tuple
-		Keys  []internal.Tuple
+		Pivot keyValue
+		Keys  []keyValue
 		Seq   uint64
 
-		WantKeys []internal.Tuple
+		WantKeys []keyValue
 	}{
-		{"seqNoMatch", makeKey2(10, 0), []internal.Tuple{makeKey(10, 2)}, 1, nil},
-		{"seqLatest", makeKey2(10, 0), []internal.Tuple{makeKey(10, 1), makeKey(10, 2), makeKey(10, 3)}, 2, []internal.Tuple{makeKey(10, 1), makeKey(10, 2)}},
-		{"seqIsolated", makeKey2(10, 0), []internal.Tuple{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, 2, []internal.Tuple{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}},
+		{"seqNoMatch", keyValue{Key: Key{10}}, []keyValue{makeKey(10, 2)}, 1, nil},
+		{"seqLatest", keyValue{Key: Key{10}}, []keyValue{makeKey(10, 1), makeKey(10, 2), makeKey(10, 3)}, 2, []keyValue{makeKey(10, 1), makeKey(10, 2)}},
+		{"seqIsolated", keyValue{Key: Key{10}}, []keyValue{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}, 2, []keyValue{makeKey(10, 1), makeKey(10, 2), makeKey(11, 1)}},
 	}
 	for _, tst := range tsts {
 		t.Run(tst.Name, func(t *testing.T) {
@@ -431,15 +1128,16 @@ func TestTransactionAscend(t *testing.T) {
 				t.Fatalf("OpenDefault failed: %v", err)
 			}
 
-			for _, k := range tst.Keys {
-				db.bt.Set(keyValue{k, []byte("anewervalue")})
+			for _, kv := range tst.Keys {
+				db.bt.Set(kv)
 			}
+			freezeClock(db)
 			db.prevSeq = tst.Seq
 
-			var got []internal.Tuple
+			var got []keyValue
 			_, err = db.Transact(func(tx Transaction) (interface{}, error) {
 				tx.ascend(tst.Pivot, func(kv keyValue) bool {
-					got = append(got, kv.Key)
+					got = append(got, kv)
 					return true
 				})
 
@@ -455,3 +1153,281 @@ func TestTransactionAscend(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactionReadYourWrites(t *testing.T) {
+	getRange := func(tx Transaction, opts RangeOptions) ([]string, error) {
+		var got []string
+		ri := tx.GetRange(KeyRange{Key{}, Key(internal.Tuple{"\xFF"}.Pack())}, opts).Iterator()
+		for ri.Advance() {
+			kv, err := ri.Get()
+			if err != nil {
+				return nil, err
+			}
+			kt, err := internal.UnpackTuple(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			got = append(got, fmt.Sprintf("%v=%s", kt[0], kv.Value))
+		}
+		return got, nil
+	}
+
+	t.Run("get", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 1, Value: []byte("avalue")})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("anewervalue"))
+			tx.Set(Key(internal.Tuple{"bkey"}.Pack()), []byte("bvalue"))
+
+			for _, tst := range []struct {
+				Key  string
+				Want []byte
+			}{
+				{"akey", []byte("anewervalue")},
+				{"bkey", []byte("bvalue")},
+			} {
+				got, err := tx.Get(Key(internal.Tuple{tst.Key}.Pack())).Get()
+				if err != nil {
+					return nil, err
+				}
+				if !reflect.DeepEqual(got, tst.Want) {
+					t.Errorf("Get(%q): got %q, want %q", tst.Key, got, tst.Want)
+				}
+			}
+
+			// Reading our own writes doesn't add read conflicts.
+			if tx.readConflicts != nil {
+				t.Errorf("Get readConflicts: got %+v, want nil", tx.readConflicts)
+			}
+
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	})
+
+	t.Run("getCleared", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 1, Value: []byte("avalue")})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(Key(internal.Tuple{"bkey"}.Pack()), []byte("bvalue"))
+			tx.ClearRange(KeyRange{Key(internal.Tuple{"akey"}.Pack()), Key(internal.Tuple{"ckey"}.Pack())})
+
+			for _, k := range []string{"akey", "bkey"} {
+				got, err := tx.Get(Key(internal.Tuple{k}.Pack())).Get()
+				if err != nil {
+					return nil, err
+				}
+				if got != nil {
+					t.Errorf("Get(%q): got %q, want nil", k, got)
+				}
+			}
+
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if got, want := db.bt.Len(), 2; got != want {
+			t.Errorf("Commit Len: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("getRange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 1, Value: []byte("avalue")})
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"ckey"}.Pack()), Seq: 1, Value: []byte("cvalue")})
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"dkey"}.Pack()), Seq: 1, Value: []byte("dvalue")})
+
+		tsts := []struct {
+			Name string
+			Opts RangeOptions
+			Want []string
+		}{
+			{"forward", RangeOptions{}, []string{"akey=anewervalue", "bkey=bvalue", "dkey=dvalue"}},
+			{"reverse", RangeOptions{Reverse: true}, []string{"dkey=dvalue", "bkey=bvalue", "akey=anewervalue"}},
+			{"limit", RangeOptions{Limit: 2}, []string{"akey=anewervalue", "bkey=bvalue"}},
+			{"reverseLimit", RangeOptions{Limit: 2, Reverse: true}, []string{"dkey=dvalue", "bkey=bvalue"}},
+		}
+		for _, tst := range tsts {
+			t.Run(tst.Name, func(t *testing.T) {
+				_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+					tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("anewervalue"))
+					tx.Set(Key(internal.Tuple{"bkey"}.Pack()), []byte("bvalue"))
+					tx.ClearRange(KeyRange{Key(internal.Tuple{"ckey"}.Pack()), Key(internal.Tuple{"dkey"}.Pack())})
+
+					got, err := getRange(tx, tst.Opts)
+					if err != nil {
+						return nil, err
+					}
+					if !reflect.DeepEqual(got, tst.Want) {
+						t.Errorf("GetRange: got %q, want %q", got, tst.Want)
+					}
+
+					tx.Cancel()
+					return nil, nil
+				})
+				if !errors.Is(err, errTransactionCancelled) {
+					t.Fatalf("Transact err: got %v, want %v", err, errTransactionCancelled)
+				}
+			})
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		db.bt.Set(keyValue{Key: Key(internal.Tuple{"akey"}.Pack()), Seq: 1, Value: []byte("avalue")})
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			if err := tx.Options().SetReadYourWritesDisable(); err != nil {
+				return nil, err
+			}
+
+			tx.Set(Key(internal.Tuple{"akey"}.Pack()), []byte("anewervalue"))
+			tx.Set(Key(internal.Tuple{"bkey"}.Pack()), []byte("bvalue"))
+
+			got, err := tx.Get(Key(internal.Tuple{"akey"}.Pack())).Get()
+			if err != nil {
+				return nil, err
+			}
+			if want := []byte("avalue"); !reflect.DeepEqual(got, want) {
+				t.Errorf("Get: got %q, want %q", got, want)
+			}
+
+			gotRange, err := getRange(tx, RangeOptions{})
+			if err != nil {
+				return nil, err
+			}
+			if want := []string{"akey=avalue"}; !reflect.DeepEqual(gotRange, want) {
+				t.Errorf("GetRange: got %q, want %q", gotRange, want)
+			}
+
+			if err := tx.Options().SetReadYourWritesDisable(); err == nil {
+				t.Errorf("SetReadYourWritesDisable err: got %v, want non-nil", err)
+			}
+
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	})
+}
+
+func TestTransactionRawKeys(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	keys := []Key{
+		Key("a"),
+		Key("a\x00"),
+		Key("ab"),
+		Key("a\xFF"),
+		Key("b"),
+		Key{0xFF, 0x00},
+	}
+	_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+		tx.Options().SetAccessSystemKeys()
+
+		// In reverse to make sure the btree sorts them.
+		for i := len(keys) - 1; i >= 0; i-- {
+			tx.Set(keys[i], []byte(keys[i]))
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	tsts := []struct {
+		Name  string
+		Range ExactRange
+
+		Want []Key
+	}{
+		{"all", KeyRange{Key{}, Key{0xFF, 0xFF}}, keys},
+		{"prefix", KeyRange{Key("a"), Key("a\xFF")}, keys[:3]},
+		{"strinc", mustPrefixRange(Key("a")), keys[:4]},
+		{"system", KeyRange{Key{0xFF}, Key{0xFF, 0xFF}}, keys[5:]},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			var got []Key
+			_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+				tx.Options().SetReadSystemKeys()
+				ri := tx.GetRange(tst.Range, RangeOptions{}).Iterator()
+				for ri.Advance() {
+					kv, err := ri.Get()
+					if err != nil {
+						return nil, err
+					}
+					if !reflect.DeepEqual([]byte(kv.Key), kv.Value) {
+						t.Errorf("GetRange value: got %q, want %q", kv.Value, kv.Key)
+					}
+					got = append(got, kv.Key)
+				}
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("Transact failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tst.Want) {
+				t.Errorf("GetRange: got %q, want %q", got, tst.Want)
+			}
+		})
+	}
+
+	t.Run("clearRange", func(t *testing.T) {
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Options().SetReadSystemKeys()
+			tx.ClearRange(KeyRange{Key("a\x00"), Key("b")})
+
+			for i, k := range keys {
+				got, err := tx.Get(k).Get()
+				if err != nil {
+					return nil, err
+				}
+				if cleared := i >= 1 && i <= 3; cleared != (got == nil) {
+					t.Errorf("Get(%q): got %q, want cleared %v", k, got, cleared)
+				}
+			}
+
+			tx.Cancel()
+			return nil, nil
+		})
+		if !errors.Is(err, errTransactionCancelled) {
+			t.Fatalf("Transact err: got %v, want %v", err, errTransactionCancelled)
+		}
+	})
+}
+
+func mustPrefixRange(prefix []byte) KeyRange {
+	kr, err := PrefixRange(prefix)
+	if err != nil {
+		panic(err)
+	}
+	return kr
+}
@@ -0,0 +1,102 @@
+package tinyfdb
+
+import "time"
+
+// GetCommittedVersion returns the version number at which a
+// successful commit modified the database. This must be called only
+// after the successful (non-error) completion of a call to Commit on
+// this Transaction. Read-only transactions have a committed version
+// of -1.
+func (t Transaction) GetCommittedVersion() (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.committedSeq == 0 {
+		return -1, nil
+	}
+	return int64(t.committedSeq), nil
+}
+
+// SetReadVersion sets the database version that the transaction will
+// read from. Versions newer than the latest commit make reads fail
+// with a future_version error. It is an error to set the read version
+// after reading.
+func (t Transaction) SetReadVersion(version int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readSeq != 0 {
+		t.setInvalidLocked(errReadVersionAlreadySet)
+		return
+	}
+	if version <= 0 {
+		t.setInvalidLocked(errVersionInvalid)
+		return
+	}
+
+	t.d.mu.Lock()
+	t.readSeq = uint64(version)
+	t.d.mu.Unlock()
+}
+
+// GetReadVersion returns the database version the transaction reads
+// from. Unless set by SetReadVersion, it is the latest version when
+// the transaction first read.
+func (t *transaction) GetReadVersion() FutureInt64 {
+	f := newFutureInt64()
+	t.goAsync(DebugGet, &f.futureBase, func() {
+		seq, err := t.getReadSeq()
+		f.set(int64(seq), err)
+	})
+	return f
+}
+
+const (
+	// versionsPerSecond is how fast versions advance with the clock.
+	versionsPerSecond = 1000000
+
+	// mvccWindowVersions is how old a read version can be before
+	// reads and commits fail with transaction_too_old. It is five
+	// seconds, like in FoundationDB.
+	mvccWindowVersions = 5 * versionsPerSecond
+)
+
+// clockVersionLocked returns the version corresponding to the current
+// time of the database clock. Like in FoundationDB, versions advance
+// about a million per second.
+func (d *database) clockVersionLocked() uint64 {
+	el := d.now().Sub(d.epoch)
+	if el < 0 {
+		el = 0
+	}
+	return uint64(el/(time.Second/versionsPerSecond)) + 1
+}
+
+// advanceVersionLocked moves the latest version forward to the clock
+// version. Versions advance even without commits.
+func (d *database) advanceVersionLocked() {
+	if v := d.clockVersionLocked(); v > d.prevSeq {
+		d.prevSeq = v
+	}
+}
+
+// nextVersionLocked returns a version for a new commit. It is always
+// after the latest version, even if commits happen within a
+// microsecond.
+func (d *database) nextVersionLocked() uint64 {
+	v := d.clockVersionLocked()
+	if v <= d.prevSeq {
+		v = d.prevSeq + 1
+	}
+	return v
+}
+
+// tooOldLocked returns whether a read version is outside the MVCC
+// window, or has been compacted.
+func (d *database) tooOldLocked(seq uint64) bool {
+	latest := d.clockVersionLocked()
+	if d.prevSeq > latest {
+		latest = d.prevSeq
+	}
+	return seq+mvccWindowVersions < latest || seq < d.oldestSeq
+}
@@ -0,0 +1,354 @@
+package tinyfdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransactionGetCommittedVersion(t *testing.T) {
+	t.Run("committed", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+
+		if got, err := tx.GetCommittedVersion(); err != nil || got != -1 {
+			t.Errorf("GetCommittedVersion(before): got %v, %v, want -1", got, err)
+		}
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		got, err := tx.GetCommittedVersion()
+		if err != nil {
+			t.Fatalf("GetCommittedVersion failed: %v", err)
+		}
+		if want := int64(db.prevSeq); got != want {
+			t.Errorf("GetCommittedVersion: got %v, want %v", got, want)
+		}
+
+		tx2, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		// Versions advance with the clock, even without commits.
+		if rv := tx2.GetReadVersion().MustGet(); rv < got {
+			t.Errorf("GetReadVersion: got %v, want at least %v", rv, got)
+		}
+	})
+
+	t.Run("readOnly", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		if got, err := tx.GetCommittedVersion(); err != nil || got != -1 {
+			t.Errorf("GetCommittedVersion: got %v, %v, want -1", got, err)
+		}
+	})
+}
+
+func TestTransactionSetReadVersion(t *testing.T) {
+	t.Run("older", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		// Keeps commit records from being pruned.
+		holder, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		holder.GetReadVersion().MustGet()
+		defer holder.Cancel()
+
+		v1 := commitValue(t, db, Key("akey"), []byte("avalue"))
+		commitValue(t, db, Key("akey"), []byte("anewervalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.SetReadVersion(v1)
+
+		got, err := tx.Get(Key("akey")).Get()
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if want := []byte("avalue"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get: got %q, want %q", got, want)
+		}
+
+		// The newer version conflicts with the read.
+		tx.Set(Key("bkey"), []byte("bvalue"))
+		if err := tx.Commit().Get(); !errors.Is(err, errNotCommitted) {
+			t.Errorf("Commit err: got %v, want %v", err, errNotCommitted)
+		}
+	})
+
+	t.Run("tooOld", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		v1 := commitValue(t, db, Key("akey"), []byte("avalue"))
+		commitValue(t, db, Key("akey"), []byte("anewervalue"))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.SetReadVersion(v1)
+		tx.Get(Key("akey")).MustGet()
+		tx.Set(Key("bkey"), []byte("bvalue"))
+
+		// The commit records needed to check conflicts are gone.
+		if err := tx.Commit().Get(); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("Commit err: got %v, want %v", err, errTransactionTooOld)
+		}
+	})
+
+	t.Run("future", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.SetReadVersion(int64(db.prevSeq) + 1000*versionsPerSecond)
+
+		if _, err := tx.Get(Key("akey")).Get(); !errors.Is(err, errFutureVersion) {
+			t.Errorf("Get err: got %v, want %v", err, errFutureVersion)
+		}
+
+		ri := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{}).Iterator()
+		if !ri.Advance() {
+			t.Fatalf("Advance: got false, want true")
+		}
+		if _, err := ri.Get(); !errors.Is(err, errFutureVersion) {
+			t.Errorf("RangeIterator.Get err: got %v, want %v", err, errFutureVersion)
+		}
+		if ri.Advance() {
+			t.Errorf("Advance(after error): got true, want false")
+		}
+	})
+
+	t.Run("alreadySet", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.GetReadVersion().MustGet()
+		tx.SetReadVersion(1)
+		tx.Set(Key("akey"), []byte("avalue"))
+
+		if err := tx.Commit().Get(); !errors.Is(err, errReadVersionAlreadySet) {
+			t.Errorf("Commit err: got %v, want %v", err, errReadVersionAlreadySet)
+		}
+	})
+}
+
+func TestDatabaseNextVersion(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	now := db.epoch
+	db.now = func() time.Time { return now }
+
+	v1 := commitValue(t, db, Key("akey"), []byte("avalue"))
+	v2 := commitValue(t, db, Key("akey"), []byte("avalue"))
+	if v2 <= v1 {
+		t.Errorf("commitValue: got %v after %v, want increasing", v2, v1)
+	}
+
+	now = now.Add(time.Second)
+	if got, want := commitValue(t, db, Key("akey"), []byte("avalue")), int64(1000001); got != want {
+		t.Errorf("commitValue(+1s): got %v, want %v", got, want)
+	}
+}
+
+// commitValue sets key to value in a new transaction and returns the
+// committed version.
+func commitValue(t *testing.T, db Database, key Key, value []byte) int64 {
+	t.Helper()
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+	tx.Set(key, value)
+	if err := tx.Commit().Get(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	v, err := tx.GetCommittedVersion()
+	if err != nil {
+		t.Fatalf("GetCommittedVersion failed: %v", err)
+	}
+	return v
+}
+
+func TestTransactionTooOld(t *testing.T) {
+	// newDB returns a database with a fake clock, and a function to
+	// advance it.
+	newDB := func(t *testing.T) (Database, func(time.Duration)) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		now := time.Unix(1000, 0)
+		db.Debug().SetClock(func() time.Time { return now })
+		return db, func(d time.Duration) { now = now.Add(d) }
+	}
+
+	t.Run("get", func(t *testing.T) {
+		db, advance := newDB(t)
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Get(Key("akey")).MustGet()
+
+		advance(5 * time.Second)
+		if _, err := tx.Get(Key("akey")).Get(); err != nil {
+			t.Fatalf("Get(5s) failed: %v", err)
+		}
+
+		advance(time.Microsecond)
+		if _, err := tx.Get(Key("akey")).Get(); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionTooOld)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+		if err := tx.Commit().Get(); !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("Commit err: got %v, want %v", err, errTransactionTooOld)
+		}
+	})
+
+	t.Run("getRange", func(t *testing.T) {
+		db, advance := newDB(t)
+
+		// Each key-value pair is eleven bytes, so a batch in
+		// StreamingModeSmall is perBatch pairs.
+		const numKeys = 100
+		perBatch := (streamingModeBytes[StreamingModeSmall] + 10) / 11
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			for i := 0; i < numKeys; i++ {
+				tx.Set(Key(fmt.Sprintf("a%04d", i)), []byte("avalue"))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		rr := tx.GetRange(KeyRange{Key("a"), Key("b")}, RangeOptions{Mode: StreamingModeSmall})
+		ri := rr.Iterator()
+		for i := 0; i < 3; i++ {
+			if !ri.Advance() {
+				t.Fatalf("Advance: got false, want true")
+			}
+			if _, err := ri.Get(); err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+		}
+
+		// A long-running scan fails when it reads the next batch.
+		// The rest of the current batch has already been read.
+		advance(6 * time.Second)
+		n := 3
+		for ri.Advance() {
+			if _, err := ri.Get(); err != nil {
+				if !errors.Is(err, errTransactionTooOld) {
+					t.Errorf("RangeIterator.Get err: got %v, want %v", err, errTransactionTooOld)
+				}
+				break
+			}
+			n++
+		}
+		if n != perBatch {
+			t.Errorf("RangeIterator: got %d keys before failing, want %d", n, perBatch)
+		}
+
+		// The slice is all or nothing.
+		kvs, err := rr.GetSliceWithError()
+		if !errors.Is(err, errTransactionTooOld) {
+			t.Errorf("GetSliceWithError err: got %v, want %v", err, errTransactionTooOld)
+		}
+		if kvs != nil {
+			t.Errorf("GetSliceWithError: got %d keys, want nil", len(kvs))
+		}
+	})
+
+	t.Run("blindWrite", func(t *testing.T) {
+		db, advance := newDB(t)
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+
+		// The read version is taken at commit.
+		advance(6 * time.Second)
+		if err := tx.Commit().Get(); err != nil {
+			t.Errorf("Commit failed: %v", err)
+		}
+	})
+
+	t.Run("transactRetries", func(t *testing.T) {
+		db, advance := newDB(t)
+
+		var i int
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			i++
+			tx.Get(Key("akey")).MustGet()
+			if i == 1 {
+				advance(6 * time.Second)
+			}
+			return tx.Get(Key("akey")).Get()
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if want := 2; i != want {
+			t.Errorf("Transact i: got %v, want %v", i, want)
+		}
+	})
+}
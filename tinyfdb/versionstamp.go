@@ -0,0 +1,165 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
+)
+
+// SetVersionstampedKey sets the value of a key that includes the
+// versionstamp of the transaction. The last four bytes of key (two
+// before API version 520) are a little-endian offset to the ten-byte
+// placeholder to replace, and are removed. Use
+// tuple.Tuple.PackWithVersionstamp to create keys.
+func (t Transaction) SetVersionstampedKey(key KeyConvertible, param []byte) {
+	t.setVersionstampedKey(key, param)
+}
+
+// SetVersionstampedValue sets the value of the key to param, with the
+// versionstamp of the transaction included. The last four bytes of
+// param are a little-endian offset to the ten-byte placeholder to
+// replace, and are removed. Before API version 520, there is no
+// offset, and the versionstamp is placed at the beginning.
+//
+// The value cannot be read within the transaction.
+func (t Transaction) SetVersionstampedValue(key KeyConvertible, param []byte) {
+	t.setVersionstampedValue(key, param)
+}
+
+// GetVersionstamp returns a future that will become ready with the
+// ten-byte versionstamp used by versionstamped keys and values, once
+// the transaction has committed. The first eight bytes are the
+// commit version. Every commit has its own version, so the last two
+// bytes, the batch order, are always zero.
+func (t Transaction) GetVersionstamp() FutureKey {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.versionstamp
+}
+
+func (t *transaction) setVersionstampedKey(key KeyConvertible, param []byte) {
+	k := key.FDBKey()
+	data, _, err := splitVersionstampOffset(k, false)
+	if err == nil {
+		err = checkWriteSize(data, param)
+	}
+	if err != nil {
+		t.setInvalid(err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.writeErrLocked(); err != nil {
+		t.setInvalidLocked(err)
+		return
+	}
+	// The versionstamp is not known until commit, so the key is
+	// checked with the placeholder.
+	if bytes.Compare(keyAfter(data), t.keyLimitLocked(true)) > 0 {
+		t.setInvalidLocked(errKeyOutsideLegalRange)
+		return
+	}
+
+	// The write conflict range is added on commit, when the key is
+	// known.
+	noWriteConflict := t.nextWriteNoWriteConflictRange
+	t.nextWriteNoWriteConflictRange = false
+	t.vsKeys = append(t.vsKeys, versionstampedKey{
+		keyValue:        keyValue{Key: append(Key(nil), k...), Value: append([]byte{}, param...)},
+		noWriteConflict: noWriteConflict,
+	})
+}
+
+// A versionstampedKey is a pending SetVersionstampedKey. The key
+// still has the offset suffix.
+type versionstampedKey struct {
+	keyValue
+	noWriteConflict bool
+}
+
+func (t *transaction) setVersionstampedValue(key KeyConvertible, param []byte) {
+	k := append(Key(nil), key.FDBKey()...)
+	data, _, err := splitVersionstampOffset(param, true)
+	if err == nil {
+		err = checkWriteSize(k, data)
+	}
+	if err != nil {
+		t.setInvalid(err)
+		return
+	}
+
+	t.write(k, keyAfter(k), func() {
+		t.writes.Set(keyValue{Key: k, Seq: pendingSeq, Ops: []mutation{{mutationSetVersionstampedValue, append([]byte{}, param...)}}})
+	})
+}
+
+// setInvalid records an error to be returned from Commit. Only the
+// first error is kept.
+func (t *transaction) setInvalid(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.setInvalidLocked(err)
+}
+
+func (t *transaction) setInvalidLocked(err error) {
+	if t.invalid == nil {
+		t.invalid = err
+	}
+}
+
+// makeVersionstamp returns the ten-byte versionstamp for a commit
+// version. Each commit has a unique version, so the batch order is
+// always zero.
+func makeVersionstamp(seq uint64) []byte {
+	vs := make([]byte, 10)
+	binary.BigEndian.PutUint64(vs, seq)
+	return vs
+}
+
+// placeVersionstamp returns the data of a versionstamped key or value
+// with the placeholder replaced by the versionstamp.
+func placeVersionstamp(bs []byte, vs []byte, isValue bool) ([]byte, error) {
+	data, off, err := splitVersionstampOffset(bs, isValue)
+	if err != nil {
+		return nil, err
+	}
+
+	r := append([]byte{}, data...)
+	copy(r[off:], vs)
+	return r, nil
+}
+
+// splitVersionstampOffset splits a versionstamped key or value into
+// the data and the offset of the placeholder.
+func splitVersionstampOffset(bs []byte, isValue bool) ([]byte, int, error) {
+	n := 4
+	if v, err := internal.GetAPIVersion(); err == nil && v < 520 {
+		if isValue {
+			n = 0
+		} else {
+			n = 2
+		}
+	}
+	if len(bs) < n {
+		return nil, 0, errClientInvalidOperation
+	}
+
+	data := bs[:len(bs)-n]
+	var off int
+	switch n {
+	case 2:
+		off = int(binary.LittleEndian.Uint16(bs[len(data):]))
+	case 4:
+		off = int(binary.LittleEndian.Uint32(bs[len(data):]))
+	}
+	if off+10 > len(data) {
+		return nil, 0, errClientInvalidOperation
+	}
+
+	return data, off, nil
+}
@@ -0,0 +1,272 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tommie/tiny-foundationdb-go/tinyfdb/internal"
+)
+
+func TestTransactionSetVersionstampedKey(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	var vss []Key
+	for i := 0; i < 2; i++ {
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		k := append(Key("log/"), internal.IncompleteTransactionVersion[:]...)
+		k = append(k, 4, 0, 0, 0)
+		tx.SetVersionstampedKey(k, []byte("avalue"))
+
+		fvs := tx.GetVersionstamp()
+		if fvs.IsReady() {
+			t.Errorf("GetVersionstamp IsReady: got true, want false")
+		}
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		vs, err := fvs.Get()
+		if err != nil {
+			t.Fatalf("GetVersionstamp failed: %v", err)
+		}
+		vss = append(vss, vs)
+	}
+
+	if len(vss[0]) != 10 || bytes.Compare(vss[0], vss[1]) >= 0 {
+		t.Errorf("GetVersionstamp: got %v, want increasing", vss)
+	}
+
+	var got []Key
+	_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+		ri := tx.GetRange(mustPrefixRange(Key("log/")), RangeOptions{}).Iterator()
+		for ri.Advance() {
+			kv, err := ri.Get()
+			if err != nil {
+				return nil, err
+			}
+			got = append(got, kv.Key)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	want := []Key{append(Key("log/"), vss[0]...), append(Key("log/"), vss[1]...)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRange: got %q, want %q", got, want)
+	}
+}
+
+func TestTransactionSetVersionstampedKeyLegalRange(t *testing.T) {
+	tsts := []struct {
+		Name             string
+		AccessSystemKeys bool
+
+		WantErr error
+	}{
+		{"user", false, errKeyOutsideLegalRange},
+		{"accessSystemKeys", true, nil},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			db, err := OpenDefault()
+			if err != nil {
+				t.Fatalf("OpenDefault failed: %v", err)
+			}
+
+			tx, err := db.CreateTransaction()
+			if err != nil {
+				t.Fatalf("CreateTransaction failed: %v", err)
+			}
+			if tst.AccessSystemKeys {
+				if err := tx.Options().SetAccessSystemKeys(); err != nil {
+					t.Fatalf("SetAccessSystemKeys failed: %v", err)
+				}
+			}
+
+			k := append(Key("\xfflog/"), internal.IncompleteTransactionVersion[:]...)
+			k = append(k, 5, 0, 0, 0)
+			tx.SetVersionstampedKey(k, []byte("avalue"))
+
+			if err := tx.Commit().Get(); !errors.Is(err, tst.WantErr) {
+				t.Errorf("Commit err: got %v, want %v", err, tst.WantErr)
+			}
+		})
+	}
+}
+
+func TestTransactionSetVersionstampedValue(t *testing.T) {
+	db, err := OpenDefault()
+	if err != nil {
+		t.Fatalf("OpenDefault failed: %v", err)
+	}
+
+	freezeClock(db)
+
+	tx, err := db.CreateTransaction()
+	if err != nil {
+		t.Fatalf("CreateTransaction failed: %v", err)
+	}
+
+	v := append([]byte("v"), internal.IncompleteTransactionVersion[:]...)
+	v = append(v, 1, 0, 0, 0)
+	tx.SetVersionstampedValue(Key("akey"), v)
+
+	if _, err := tx.Get(Key("akey")).Get(); !errors.Is(err, errAccessedUnreadable) {
+		t.Errorf("Get err: got %v, want %v", err, errAccessedUnreadable)
+	}
+
+	ri := tx.GetRange(KeyRange{Key(""), Key("\xFF")}, RangeOptions{}).Iterator()
+	if !ri.Advance() {
+		t.Fatalf("Advance: got false, want true")
+	}
+	if _, err := ri.Get(); !errors.Is(err, errAccessedUnreadable) {
+		t.Errorf("RangeIterator.Get err: got %v, want %v", err, errAccessedUnreadable)
+	}
+
+	if err := tx.Commit().Get(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	vs := tx.GetVersionstamp().MustGet()
+	want := keyValue{Key: Key("akey"), Seq: 2, Value: append([]byte("v"), vs...)}
+	if got := db.bt.Get(want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get: got %+v, want %+v", got, want)
+	}
+}
+
+func TestTransactionGetVersionstamp(t *testing.T) {
+	t.Run("readOnly", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		if _, err := tx.GetVersionstamp().Get(); err == nil {
+			t.Errorf("GetVersionstamp err: got %v, want non-nil", err)
+		}
+	})
+
+	t.Run("batchOrder", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Set(Key("akey"), []byte("avalue"))
+		fvs := tx.GetVersionstamp()
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		vs, err := fvs.Get()
+		if err != nil {
+			t.Fatalf("GetVersionstamp failed: %v", err)
+		}
+		cv, err := tx.GetCommittedVersion()
+		if err != nil {
+			t.Fatalf("GetCommittedVersion failed: %v", err)
+		}
+		want := make(Key, 10)
+		binary.BigEndian.PutUint64(want, uint64(cv))
+		if !bytes.Equal(vs, want) {
+			t.Errorf("GetVersionstamp: got %v, want %v", vs, want)
+		}
+	})
+
+	t.Run("invalidOffset", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+
+		tx.SetVersionstampedKey(Key("akey\x00\x00\x00\x00"), []byte("avalue"))
+
+		if err := tx.Commit().Get(); err == nil {
+			t.Errorf("Commit err: got %v, want non-nil", err)
+		}
+		if _, err := tx.GetVersionstamp().Get(); err == nil {
+			t.Errorf("GetVersionstamp err: got %v, want non-nil", err)
+		}
+	})
+}
+
+func TestPlaceVersionstamp(t *testing.T) {
+	vs := []byte("0123456789")
+	placeholder := internal.IncompleteTransactionVersion[:]
+	cat := func(bss ...[]byte) []byte {
+		var ret []byte
+		for _, bs := range bss {
+			ret = append(ret, bs...)
+		}
+		return ret
+	}
+
+	tsts := []struct {
+		Name    string
+		Version int // Zero if not selected.
+		IsValue bool
+		In      []byte
+
+		Want    []byte
+		WantErr error
+	}{
+		{"keyDefault", 0, false, cat([]byte("k"), placeholder, []byte{1, 0, 0, 0}), cat([]byte("k"), vs), nil},
+		{"key520", 520, false, cat([]byte("k"), placeholder, []byte{1, 0, 0, 0}), cat([]byte("k"), vs), nil},
+		{"key510", 510, false, cat([]byte("k"), placeholder, []byte{1, 0}), cat([]byte("k"), vs), nil},
+		{"valueDefault", 0, true, cat([]byte("v"), placeholder, []byte{1, 0, 0, 0}), cat([]byte("v"), vs), nil},
+		{"value510", 510, true, cat(placeholder, []byte("v")), cat(vs, []byte("v")), nil},
+		{"offsetOutOfRange", 0, false, cat([]byte("k"), placeholder, []byte{2, 0, 0, 0}), nil, errClientInvalidOperation},
+		{"noOffset", 0, false, []byte{1, 0}, nil, errClientInvalidOperation},
+	}
+	for _, tst := range tsts {
+		t.Run(tst.Name, func(t *testing.T) {
+			t.Cleanup(internal.ClearAPIVersion)
+
+			if tst.Version != 0 {
+				if err := APIVersion(tst.Version); err != nil {
+					t.Fatalf("APIVersion failed: %v", err)
+				}
+			}
+
+			got, err := placeVersionstamp(tst.In, vs, tst.IsValue)
+			if !errors.Is(err, tst.WantErr) {
+				t.Fatalf("placeVersionstamp err: got %v, want %v", err, tst.WantErr)
+			}
+			if !bytes.Equal(got, tst.Want) {
+				t.Errorf("placeVersionstamp: got %q, want %q", got, tst.Want)
+			}
+		})
+	}
+}
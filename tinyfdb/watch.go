@@ -0,0 +1,176 @@
+package tinyfdb
+
+import (
+	"bytes"
+	"time"
+)
+
+// defaultMaxWatches is the number of active watches a database
+// allows. It is the same as the FoundationDB default.
+const defaultMaxWatches = 10000
+
+// A watch is a FutureNil that becomes ready when the value of a key
+// changes. It is pending until the transaction that created it
+// commits, and then active until it fires or is cancelled.
+type watch struct {
+	*futureNil
+
+	d     *database
+	key   Key
+	read  FutureByteSlice // Reads the value as seen by the transaction.
+	value []byte          // The result of read, set before commit. Mutex: d.mu
+}
+
+// Watch creates a watch and returns a FutureNil that will become
+// ready when the watch reports a change to the value of the specified
+// key.
+//
+// A watch's behavior is relative to the transaction that created
+// it. A watch will report a change in relation to the key's value as
+// readable by that transaction. The initial value used for comparison
+// is either that of the transaction's read version or the value as
+// modified by the transaction itself prior to the creation of the
+// watch. If the value changes and then changes back to its initial
+// value, the watch might not report the change.
+//
+// Until the transaction that created it has been committed, a watch
+// will not report changes made by other transactions. In contrast, a
+// watch will report changes made by the transaction itself. Watches
+// cannot be created if the transaction has disabled read-your-writes.
+// If the transaction fails to commit, or is cancelled or reset, the
+// watch fails with an error. Watches cannot be created after Commit
+// has been called, or the transaction has been cancelled.
+func (t *transaction) Watch(key KeyConvertible) FutureNil {
+	w := &watch{futureNil: newFutureNil(), d: t.d, key: append(Key(nil), key.FDBKey()...)}
+	t.mu.RLock()
+	err := t.writeErrLocked()
+	readYourWrites := t.readYourWrites
+	t.mu.RUnlock()
+	if err != nil {
+		w.set(err)
+		return w
+	}
+	if !readYourWrites {
+		w.set(errWatchesDisabled)
+		return w
+	}
+
+	// The value is read asynchronously, at the read version of the
+	// transaction, which is fixed now. Commit waits for it, before
+	// the watch is activated.
+	if _, err := t.getReadSeq(); err != nil {
+		w.set(err)
+		return w
+	}
+	w.read = t.get(w.key, true)
+	if w.read.IsReady() {
+		if _, err := w.read.Get(); err != nil {
+			w.set(err)
+			return w
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Commit or Cancel may have been called while reading.
+	if err := t.writeErrLocked(); err != nil {
+		w.set(err)
+		return w
+	}
+
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+
+	t.watches = append(t.watches, w)
+	return w
+}
+
+// readWatchValues waits for the values read by the pending watches.
+// Waiting may run queued operations, so d.mu must not be held.
+func (t *transaction) readWatchValues() {
+	t.d.mu.Lock()
+	ws := append([]*watch(nil), t.watches...)
+	t.d.mu.Unlock()
+
+	for _, w := range ws {
+		v, err := w.read.Get()
+		if err != nil {
+			// activateWatchesLocked skips ready watches.
+			w.set(err)
+			continue
+		}
+
+		t.d.mu.Lock()
+		w.value = v
+		t.d.mu.Unlock()
+	}
+}
+
+// Cancel makes the watch fail with an operation_cancelled error,
+// unless it has already fired.
+func (w *watch) Cancel() {
+	// Making it ready first means activateWatchesLocked will skip
+	// it.
+	w.futureNil.Cancel()
+
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+
+	delete(w.d.watches, w)
+}
+
+// changedLocked returns whether the latest committed value differs
+// from the one the watch was created with.
+func (w *watch) changedLocked() bool {
+	v := w.d.latestLocked(w.key)
+	return (v == nil) != (w.value == nil) || !bytes.Equal(v, w.value)
+}
+
+// activateWatchesLocked makes the pending watches of a committed
+// transaction active. Watches whose key has already changed fire
+// immediately.
+func (t *transaction) activateWatchesLocked() {
+	for _, w := range t.watches {
+		switch {
+		case w.IsReady():
+			// Cancelled, or failed to read the value.
+		case w.changedLocked():
+			t.d.fireWatchLocked(w)
+		case len(t.d.watches) >= t.d.maxWatches:
+			w.set(errTooManyWatches)
+		default:
+			t.d.watches[w] = struct{}{}
+		}
+	}
+	t.watches = nil
+}
+
+// failWatchesLocked makes the pending watches fail with err.
+func (t *transaction) failWatchesLocked(err error) {
+	for _, w := range t.watches {
+		w.set(err)
+	}
+	t.watches = nil
+}
+
+// fireWatchesLocked makes active watches ready if a commit changed
+// their keys, and they now have a different value.
+func (d *database) fireWatchesLocked(changed func(Key) bool) {
+	for w := range d.watches {
+		if changed(w.key) && w.changedLocked() {
+			delete(d.watches, w)
+			d.fireWatchLocked(w)
+		}
+	}
+}
+
+// fireWatchLocked makes the watch ready, after any injected latency.
+func (d *database) fireWatchLocked(w *watch) {
+	lat := d.latencyLocked(DebugWatch)
+	if lat <= 0 {
+		w.set(nil)
+		return
+	}
+	time.AfterFunc(lat, func() { w.set(nil) })
+}
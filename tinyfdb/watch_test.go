@@ -0,0 +1,414 @@
+package tinyfdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransactionWatch(t *testing.T) {
+	// watchKey returns a watch on akey, created in a committed
+	// transaction.
+	watchKey := func(t *testing.T, db Database) FutureNil {
+		t.Helper()
+
+		w, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			return tx.Watch(Key("akey")), nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+		return w.(FutureNil)
+	}
+	setKey := func(t *testing.T, db Database, key Key, value []byte) {
+		t.Helper()
+
+		_, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.Set(key, value)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+	}
+
+	t.Run("firesOnChange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		w := watchKey(t, db)
+
+		if w.IsReady() {
+			t.Fatalf("IsReady: got true, want false")
+		}
+
+		setKey(t, db, Key("bkey"), []byte("bvalue"))
+		if w.IsReady() {
+			t.Errorf("IsReady(other key): got true, want false")
+		}
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		if w.IsReady() {
+			t.Errorf("IsReady(same value): got true, want false")
+		}
+
+		setKey(t, db, Key("akey"), []byte("anewvalue"))
+		w.BlockUntilReady()
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+		if got := len(db.watches); got != 0 {
+			t.Errorf("watches: got %v, want 0", got)
+		}
+	})
+
+	t.Run("firesOnCreate", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		w := watchKey(t, db)
+
+		// An empty value is different from a missing key.
+		setKey(t, db, Key("akey"), []byte{})
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("firesOnClearRange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		w := watchKey(t, db)
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			tx.ClearRange(KeyRange{Key("a"), Key("b")})
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("firesWithoutWriteConflictRange", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		w := watchKey(t, db)
+
+		_, err = db.Transact(func(tx Transaction) (interface{}, error) {
+			if err := tx.Options().SetNextWriteNoWriteConflictRange(); err != nil {
+				return nil, err
+			}
+			tx.Set(Key("akey"), []byte("avalue"))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("readLatency", func(t *testing.T) {
+		const lat = 300 * time.Millisecond
+
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		db.Debug().SetLatency(DebugGet, ConstantLatency(lat))
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		start := time.Now()
+		w := tx.Watch(Key("akey"))
+		if got := time.Since(start); got >= lat/2 {
+			t.Errorf("Watch elapsed: got %v, want less than %v", got, lat/2)
+		}
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		// The value read by the watch is used.
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		if w.IsReady() {
+			t.Errorf("IsReady(same value): got true, want false")
+		}
+		setKey(t, db, Key("akey"), []byte("anewvalue"))
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("randomCompletionOrder", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		db.Debug().SetRandomCompletionOrder(true)
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		w := watchKey(t, db)
+		if w.IsReady() {
+			t.Fatalf("IsReady: got true, want false")
+		}
+
+		setKey(t, db, Key("akey"), []byte("anewvalue"))
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("ownWrite", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		w, err := db.Transact(func(tx Transaction) (interface{}, error) {
+			w := tx.Watch(Key("akey"))
+			tx.Set(Key("akey"), []byte("avalue"))
+			return w, nil
+		})
+		if err != nil {
+			t.Fatalf("Transact failed: %v", err)
+		}
+
+		if err := w.(FutureNil).Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("pendingUntilCommit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		w := tx.Watch(Key("akey"))
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		if w.IsReady() {
+			t.Errorf("IsReady(before commit): got true, want false")
+		}
+
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if err := w.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		w := watchKey(t, db)
+		w.Cancel()
+
+		if err := w.Get(); !errors.Is(err, errOperationCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errOperationCancelled)
+		}
+		if got := len(db.watches); got != 0 {
+			t.Errorf("watches: got %v, want 0", got)
+		}
+
+		// Cancelling a ready future has no effect.
+		setKey(t, db, Key("akey"), []byte("avalue"))
+		w2 := watchKey(t, db)
+		setKey(t, db, Key("akey"), []byte("anewvalue"))
+		w2.Cancel()
+		if err := w2.Get(); err != nil {
+			t.Errorf("Get failed: %v", err)
+		}
+	})
+
+	t.Run("cancelBeforeCommit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		w := tx.Watch(Key("akey"))
+		w.Cancel()
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		if err := w.Get(); !errors.Is(err, errOperationCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errOperationCancelled)
+		}
+		if got := len(db.watches); got != 0 {
+			t.Errorf("watches: got %v, want 0", got)
+		}
+	})
+
+	t.Run("failedCommit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Get(Key("akey")).MustGet()
+		w := tx.Watch(Key("akey"))
+		tx.Set(Key("bkey"), []byte("bvalue"))
+
+		setKey(t, db, Key("akey"), []byte("avalue"))
+
+		if err := tx.Commit().Get(); !errors.Is(err, errNotCommitted) {
+			t.Fatalf("Commit err: got %v, want %v", err, errNotCommitted)
+		}
+		if err := w.Get(); !errors.Is(err, errNotCommitted) {
+			t.Errorf("Get err: got %v, want %v", err, errNotCommitted)
+		}
+	})
+
+	t.Run("transactionCancelled", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		w := tx.Watch(Key("akey"))
+		tx.Cancel()
+
+		if err := w.Get(); !errors.Is(err, errTransactionCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionCancelled)
+		}
+	})
+
+	t.Run("afterCancel", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.Cancel()
+		w := tx.Watch(Key("akey"))
+
+		if err := w.Get(); !errors.Is(err, errTransactionCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionCancelled)
+		}
+	})
+
+	t.Run("afterCommit", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		if err := tx.Commit().Get(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		w := tx.Watch(Key("akey"))
+		setKey(t, db, Key("akey"), []byte("avalue"))
+
+		if err := w.Get(); !errors.Is(err, errUsedDuringCommit) {
+			t.Errorf("Get err: got %v, want %v", err, errUsedDuringCommit)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		w := tx.Watch(Key("akey"))
+		tx.Reset()
+
+		if err := w.Get(); !errors.Is(err, errTransactionCancelled) {
+			t.Errorf("Get err: got %v, want %v", err, errTransactionCancelled)
+		}
+	})
+
+	t.Run("tooManyWatches", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+		db.maxWatches = 1
+
+		w1 := watchKey(t, db)
+		w2 := watchKey(t, db)
+
+		if err := w2.Get(); !errors.Is(err, errTooManyWatches) {
+			t.Errorf("Get err: got %v, want %v", err, errTooManyWatches)
+		}
+
+		// Cancelling frees a slot.
+		w1.Cancel()
+		w3 := watchKey(t, db)
+		if w3.IsReady() {
+			t.Errorf("IsReady: got true, want false")
+		}
+	})
+
+	t.Run("readYourWritesDisabled", func(t *testing.T) {
+		db, err := OpenDefault()
+		if err != nil {
+			t.Fatalf("OpenDefault failed: %v", err)
+		}
+
+		tx, err := db.CreateTransaction()
+		if err != nil {
+			t.Fatalf("CreateTransaction failed: %v", err)
+		}
+		tx.readYourWrites = false
+
+		if err := tx.Watch(Key("akey")).Get(); !errors.Is(err, errWatchesDisabled) {
+			t.Errorf("Get err: got %v, want %v", err, errWatchesDisabled)
+		}
+	})
+}